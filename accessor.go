@@ -0,0 +1,213 @@
+package qjson
+
+import (
+	"fmt"
+	"strconv"
+)
+
+/* error-returning accessors, the panicking As* methods are built on them */
+
+// TryAsString as string like AsString, error is returned if node is not a simple value
+func (n *Node) TryAsString() (string, error) {
+	switch n.Type {
+	case String:
+		s, err := stdUnmarshalString([]byte(n.Value))
+		if err != nil {
+			return "", fmt.Errorf("%v `%s`", err, n.Value)
+		}
+		return bytesToString(s), nil
+	case Bool:
+		if n.Value == trueVal {
+			return trueVal, nil
+		}
+		return falseVal, nil
+	case Integer, Float:
+		return n.Value, nil
+	}
+	return "", &TypeError{Expected: []NodeType{String, Bool, Integer, Float}, Actual: n.Type}
+}
+
+// TryAsBool as boolean, error is returned if node is not a bool
+func (n *Node) TryAsBool() (bool, error) {
+	if n.Type != Bool {
+		return false, &TypeError{Expected: []NodeType{Bool}, Actual: n.Type}
+	}
+	return n.Value == trueVal, nil
+}
+
+// TryAsInt as integer, error is returned if node is not an integer or overflows int64
+func (n *Node) TryAsInt() (int64, error) {
+	if n.Type != Integer {
+		return 0, &TypeError{Expected: []NodeType{Integer}, Actual: n.Type}
+	}
+	return strconv.ParseInt(n.Value, 10, 64)
+}
+
+// TryAsUint as unsigned integer, error is returned if node is not an integer or out of uint64 range
+func (n *Node) TryAsUint() (uint64, error) {
+	if n.Type != Integer {
+		return 0, &TypeError{Expected: []NodeType{Integer}, Actual: n.Type}
+	}
+	return strconv.ParseUint(n.Value, 10, 64)
+}
+
+// TryAsFloat as float64, error is returned if node is not a float
+func (n *Node) TryAsFloat() (float64, error) {
+	if n.Type != Float {
+		return 0, &TypeError{Expected: []NodeType{Float}, Actual: n.Type}
+	}
+	return strconv.ParseFloat(n.Value, 64)
+}
+
+// TryAsMap as map, error is returned if node is not an object or null
+func (n *Node) TryAsMap() (map[string]*Node, error) {
+	if n.Type != Null && n.Type != Object {
+		return nil, &TypeError{Expected: []NodeType{Object, Null}, Actual: n.Type}
+	}
+	n.expand()
+	m := make(map[string]*Node)
+	for i, kv := range n.ObjectValues {
+		m[kv.Key.AsString()] = n.ObjectValues[i].Value
+	}
+	return m, nil
+}
+
+// TryGetObjectElemByKey get object value by key, nil is returned if not found, error is returned if node is not an object or null
+func (n *Node) TryGetObjectElemByKey(key string) (*ObjectElem, error) {
+	if n.Type != Null && n.Type != Object {
+		return nil, &TypeError{Expected: []NodeType{Object, Null}, Actual: n.Type}
+	}
+	if i := n.expand().objectIndexOf(key); i >= 0 {
+		return n.ObjectValues[i], nil
+	}
+	return nil, nil
+}
+
+// TryRemoveObjectElemByKey remove object element, error is returned if node is not an object or null
+func (n *Node) TryRemoveObjectElemByKey(key string) (bool, error) {
+	if n.Type != Null && n.Type != Object {
+		return false, &TypeError{Expected: []NodeType{Object, Null}, Actual: n.Type}
+	}
+	return n.removeObjectElemByKey(key), nil
+}
+
+/* nil-safe path getters */
+
+// GetNode find node by path like Find, but NotFoundError is returned instead of nil
+func (tree *JSONTree) GetNode(path string) (*Node, error) {
+	paths, ok := makeStPath(path)
+	if !ok {
+		return nil, fmt.Errorf("invalid path %q", path)
+	}
+	var node *Node
+	if tree != nil {
+		node = findNode(tree.Root, paths)
+	}
+	if node == nil {
+		return nil, &NotFoundError{Path: path}
+	}
+	return node, nil
+}
+
+// GetString find string by path, see Node.TryAsString
+func (tree *JSONTree) GetString(path string) (string, error) {
+	n, err := tree.GetNode(path)
+	if err != nil {
+		return "", err
+	}
+	s, err := n.TryAsString()
+	return s, errorAtPath(err, path)
+}
+
+// GetStringOr find string by path, def is returned if not found or node is not a simple value
+func (tree *JSONTree) GetStringOr(path string, def string) string {
+	if s, err := tree.GetString(path); err == nil {
+		return s
+	}
+	return def
+}
+
+// GetBool find boolean by path
+func (tree *JSONTree) GetBool(path string) (bool, error) {
+	n, err := tree.GetNode(path)
+	if err != nil {
+		return false, err
+	}
+	b, err := n.TryAsBool()
+	return b, errorAtPath(err, path)
+}
+
+// GetBoolOr find boolean by path, def is returned if not found or node is not a bool
+func (tree *JSONTree) GetBoolOr(path string, def bool) bool {
+	if b, err := tree.GetBool(path); err == nil {
+		return b
+	}
+	return def
+}
+
+// GetInt find integer by path
+func (tree *JSONTree) GetInt(path string) (int64, error) {
+	n, err := tree.GetNode(path)
+	if err != nil {
+		return 0, err
+	}
+	i, err := n.TryAsInt()
+	return i, errorAtPath(err, path)
+}
+
+// GetIntOr find integer by path, def is returned if not found or node is not an int64
+func (tree *JSONTree) GetIntOr(path string, def int64) int64 {
+	if i, err := tree.GetInt(path); err == nil {
+		return i
+	}
+	return def
+}
+
+// GetUint find unsigned integer by path
+func (tree *JSONTree) GetUint(path string) (uint64, error) {
+	n, err := tree.GetNode(path)
+	if err != nil {
+		return 0, err
+	}
+	i, err := n.TryAsUint()
+	return i, errorAtPath(err, path)
+}
+
+// GetUintOr find unsigned integer by path, def is returned if not found or node is not an uint64
+func (tree *JSONTree) GetUintOr(path string, def uint64) uint64 {
+	if i, err := tree.GetUint(path); err == nil {
+		return i
+	}
+	return def
+}
+
+// GetFloat find float by path
+func (tree *JSONTree) GetFloat(path string) (float64, error) {
+	n, err := tree.GetNode(path)
+	if err != nil {
+		return 0, err
+	}
+	f, err := n.TryAsFloat()
+	return f, errorAtPath(err, path)
+}
+
+// GetFloatOr find float by path, def is returned if not found or node is not a float
+func (tree *JSONTree) GetFloatOr(path string, def float64) float64 {
+	if f, err := tree.GetFloat(path); err == nil {
+		return f
+	}
+	return def
+}
+
+/* errorAtPath fill path into error of node accessors */
+func errorAtPath(err error, path string) error {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case *TypeError:
+		e.Path = path
+		return e
+	default:
+		return fmt.Errorf("%w at path %q", err, path)
+	}
+}
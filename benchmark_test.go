@@ -3,6 +3,8 @@ package qjson
 import (
 	"encoding/json"
 	"io/ioutil"
+	"strconv"
+	"strings"
 	"testing"
 )
 
@@ -29,6 +31,129 @@ func BenchmarkUnmarshalQJSON(b *testing.B) {
 	}
 }
 
+func BenchmarkUnmarshalQJSONLazy(b *testing.B) {
+	opts := DecodeOptions{Lazy: true}
+	for i := 0; i < b.N; i++ {
+		if tree, err := DecodeWithOptions(textTpl, opts); err != nil {
+			b.Fatal(err)
+		} else if tree.Find("status").AsString() != "OK" {
+			b.Fatal("should find status")
+		} else {
+			tree.Release()
+		}
+	}
+}
+
+func BenchmarkGetQJSON(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if node, err := Get(textTpl, "status"); err != nil {
+			b.Fatal(err)
+		} else if node.AsString() != "OK" {
+			b.Fatal("should find status")
+		}
+	}
+}
+
+func BenchmarkHashQJSON(b *testing.B) {
+	t, err := Decode(textTpl)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t.Root.Rehash()
+	}
+}
+
+func BenchmarkEqualQJSON(b *testing.B) {
+	t1, err1 := Decode(textTpl)
+	t2, err2 := Decode(textTpl)
+	if err1 != nil || err2 != nil {
+		b.Fatal(err1, err2)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if !t1.Equal(t2) {
+			b.Fatal("should be equal")
+		}
+	}
+}
+
+func BenchmarkDiffQJSON(b *testing.B) {
+	t1, err1 := Decode(textTpl)
+	t2, err2 := Decode(textTpl)
+	if err1 != nil || err2 != nil {
+		b.Fatal(err1, err2)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if Diff(t1, t2).Exist() {
+			b.Fatal("should be equal")
+		}
+	}
+}
+
+func BenchmarkMarshalDeepQJSON(b *testing.B) {
+	const depth = 100000
+	t, err := Decode([]byte(strings.Repeat("[", depth) + strings.Repeat("]", depth)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := t.MarshalJSON(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeParallelQJSON(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteByte(arrayStart)
+	for i := 0; i < 200; i++ {
+		if i > 0 {
+			sb.WriteByte(commaChar)
+		}
+		sb.Write(textTpl)
+	}
+	sb.WriteByte(arrayEnd)
+	data := []byte(sb.String())
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(strconv.Itoa(workers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if tree, err := DecodeParallel(data, workers); err != nil {
+					b.Fatal(err)
+				} else {
+					tree.Release()
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkFindBigObjectQJSON(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteByte(objectStart)
+	for i := 0; i < 1000; i++ {
+		if i > 0 {
+			sb.WriteByte(commaChar)
+		}
+		sb.WriteString(`"key` + strconv.Itoa(i) + `":` + strconv.Itoa(i))
+	}
+	sb.WriteByte(objectEnd)
+	t, err := Decode([]byte(sb.String()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if t.Find("key999").AsInt() != 999 || t.Find("missing") != nil {
+			b.Fatal("should find key999 only")
+		}
+	}
+}
+
 func BenchmarkMarshalStd(b *testing.B) {
 	m := make(map[string]interface{})
 	if err := json.Unmarshal(textTpl, &m); err != nil {
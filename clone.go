@@ -0,0 +1,119 @@
+package qjson
+
+import "strconv"
+
+// Clone deep copy json tree, see Node.Clone
+func (tree *JSONTree) Clone() *JSONTree {
+	return &JSONTree{Root: tree.Root.Clone()}
+}
+
+// Clone deep copy node and offspring by pool, values are copied into memory owned by the copy like JSONTree.Detach.
+// Lazy containers stay lazy in the copy. A node shared by several parents is copied for each of them.
+func (n *Node) Clone() *Node {
+	if n == nil {
+		return nil
+	}
+	type cloneFrame struct {
+		src, dst *Node
+	}
+	var stack []cloneFrame
+	/* push allocates copy of child, it's filled when popped from stack, nil child has no copy */
+	push := func(src *Node) *Node {
+		if src == nil {
+			return nil
+		}
+		dst := CreateNode()
+		stack = append(stack, cloneFrame{src: src, dst: dst})
+		return dst
+	}
+	root := push(n)
+	for len(stack) > 0 {
+		frame := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		src, dst := frame.src, frame.dst
+		dst.Type, dst.Value, dst.hashId = src.Type, src.Value, src.hashId
+		if src.lazy != nil {
+			dst.lazy = &lazySpan{raw: src.lazy.raw, opts: src.lazy.opts}
+		}
+		if ext := src.loadExt(); ext != nil && (ext.pos != nil || ext.trivia != nil) {
+			/* key index is rebuilt by lookups of the copy */
+			dst.ext = &nodeExt{}
+			if ext.pos != nil {
+				pos := *ext.pos
+				dst.ext.pos = &pos
+			}
+			if ext.trivia != nil {
+				tr := *ext.trivia
+				dst.ext.trivia = &tr
+			}
+		}
+		if src.ObjectValues != nil {
+			dst.ObjectValues = make([]*ObjectElem, len(src.ObjectValues))
+			for i, elem := range src.ObjectValues {
+				if elem != nil {
+					e := CreateObjectElem()
+					e.Key, e.Value = push(elem.Key), push(elem.Value)
+					dst.ObjectValues[i] = e
+				}
+			}
+		}
+		if src.ArrayValues != nil {
+			dst.ArrayValues = make([]*Node, len(src.ArrayValues))
+			for i, elem := range src.ArrayValues {
+				dst.ArrayValues[i] = push(elem)
+			}
+		}
+	}
+	detachNode(root)
+	return root
+}
+
+// CheckShared is a debug check for aliasing, error is returned if a node or object element is reachable from two parents,
+// e.g. one node is set into two places by SetObjectNodeElem. Releasing such a tree corrupts both places, use Node.Clone instead.
+// Lazy containers are not expanded.
+func (tree *JSONTree) CheckShared() error {
+	type checkFrame struct {
+		node *Node
+		path *diffPath
+	}
+	/* paths are linked to their parents, path strings are built only when a shared node is found */
+	seen := make(map[interface{}]*diffPath)
+	visit := func(ptr interface{}, path *diffPath) error {
+		if other, ok := seen[ptr]; ok {
+			return &SharedNodeError{Path: other.String(), OtherPath: path.String()}
+		}
+		seen[ptr] = path
+		return nil
+	}
+	stack := []checkFrame{{node: tree.Root}}
+	for len(stack) > 0 {
+		frame := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		node := frame.node
+		if node == nil {
+			continue
+		}
+		if err := visit(node, frame.path); err != nil {
+			return err
+		}
+		for _, elem := range node.ObjectValues {
+			if elem == nil {
+				continue
+			}
+			path := &diffPath{parent: frame.path, name: escapePathKey(keyName(elem.Key))}
+			if err := visit(elem, path); err != nil {
+				return err
+			}
+			if elem.Key != nil {
+				if err := visit(elem.Key, path); err != nil {
+					return err
+				}
+			}
+			stack = append(stack, checkFrame{node: elem.Value, path: path})
+		}
+		for i, elem := range node.ArrayValues {
+			stack = append(stack, checkFrame{node: elem, path: &diffPath{parent: frame.path, name: strconv.Itoa(i)}})
+		}
+	}
+	return nil
+}
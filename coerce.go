@@ -0,0 +1,221 @@
+package qjson
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ErrLossyConversion is wrapped by errors of To* accessors when conversion would lose information, e.g. 12.5 to integer
+var ErrLossyConversion = errors.New("lossy conversion")
+
+// Coercion describe rules of converting node between types, see Node.ToInt
+type Coercion struct {
+	// ParseStrings converts strings holding json numbers or booleans, e.g. "42", "-1.5e3", "true"
+	ParseStrings bool
+	// NumberToBool converts 0 to false and 1 to true, other numbers are lossy
+	NumberToBool bool
+	// BoolToNumber converts true to 1 and false to 0
+	BoolToNumber bool
+	// NullAsZero converts null to zero value of target type
+	NullAsZero bool
+	// Lossy allows lossy conversions: fraction is truncated when converting to integer,
+	// big integers are rounded when converting to float, and non-zero numbers are true
+	Lossy bool
+}
+
+// DefaultCoercion is used by To* accessors of Node
+var DefaultCoercion = Coercion{ParseStrings: true, NumberToBool: true, BoolToNumber: true}
+
+// ToInt convert node to int64 by DefaultCoercion, e.g. "42", 12.0 and 1.2e1 are 12
+func (n *Node) ToInt() (int64, error) {
+	return DefaultCoercion.ToInt(n)
+}
+
+// ToUint convert node to uint64 by DefaultCoercion
+func (n *Node) ToUint() (uint64, error) {
+	return DefaultCoercion.ToUint(n)
+}
+
+// ToFloat convert node to float64 by DefaultCoercion
+func (n *Node) ToFloat() (float64, error) {
+	return DefaultCoercion.ToFloat(n)
+}
+
+// ToBool convert node to boolean by DefaultCoercion, e.g. "true" and 1 are true
+func (n *Node) ToBool() (bool, error) {
+	return DefaultCoercion.ToBool(n)
+}
+
+// ToString convert node to string by DefaultCoercion, numbers keep their json text
+func (n *Node) ToString() (string, error) {
+	return DefaultCoercion.ToString(n)
+}
+
+// ToInt convert node to int64
+func (c Coercion) ToInt(n *Node) (int64, error) {
+	text, err := c.numberText(n)
+	if err != nil {
+		return 0, err
+	}
+	if isIntegerText(text) {
+		return strconv.ParseInt(text, 10, 64)
+	}
+	i, err := c.toBigInt(text)
+	if err != nil {
+		return 0, err
+	} else if !i.IsInt64() {
+		return 0, rangeError(text)
+	}
+	return i.Int64(), nil
+}
+
+// ToUint convert node to uint64
+func (c Coercion) ToUint(n *Node) (uint64, error) {
+	text, err := c.numberText(n)
+	if err != nil {
+		return 0, err
+	}
+	if isIntegerText(text) {
+		return strconv.ParseUint(text, 10, 64)
+	}
+	i, err := c.toBigInt(text)
+	if err != nil {
+		return 0, err
+	} else if !i.IsUint64() {
+		return 0, rangeError(text)
+	}
+	return i.Uint64(), nil
+}
+
+// ToFloat convert node to float64
+func (c Coercion) ToFloat(n *Node) (float64, error) {
+	text, err := c.numberText(n)
+	if err != nil {
+		return 0, err
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return 0, err
+	}
+	/* integers with at most 15 digits are exact in float64 */
+	if !c.Lossy && isIntegerText(text) && len(strings.TrimPrefix(text, "-")) > 15 {
+		i, _ := new(big.Int).SetString(text, 10)
+		if _, acc := new(big.Float).SetInt(i).Float64(); acc != big.Exact {
+			return 0, lossyError(text, Float)
+		}
+	}
+	return f, nil
+}
+
+// ToBool convert node to boolean
+func (c Coercion) ToBool(n *Node) (bool, error) {
+	switch {
+	case n.Type == Bool:
+		return n.Value == trueVal, nil
+	case n.Type == String && c.ParseStrings:
+		s, err := n.TryAsString()
+		if err != nil {
+			return false, err
+		}
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+		return false, fmt.Errorf("%s is not a boolean", n.Value)
+	case n.IsNumber() && c.NumberToBool:
+		f, err := strconv.ParseFloat(n.Value, 64)
+		if err != nil {
+			return false, err
+		}
+		if f == 0 || f == 1 || c.Lossy {
+			return f != 0, nil
+		}
+		return false, lossyError(n.Value, Bool)
+	case n.Type == Null && c.NullAsZero:
+		return false, nil
+	}
+	return false, &TypeError{Expected: c.accepted(Bool, Integer, Float, String), Actual: n.Type}
+}
+
+// ToString convert node to string
+func (c Coercion) ToString(n *Node) (string, error) {
+	if n.Type == Null && c.NullAsZero {
+		return "", nil
+	}
+	return n.TryAsString()
+}
+
+/* numberText returns json number text of node by rules */
+func (c Coercion) numberText(n *Node) (string, error) {
+	switch {
+	case n.IsNumber():
+		return n.Value, nil
+	case n.Type == String && c.ParseStrings:
+		s, err := n.TryAsString()
+		if err != nil {
+			return "", err
+		}
+		if end, errOffset := scanStrictNumber(stringToBytes(s), 0); s == "" || errOffset >= 0 || end != len(s) {
+			return "", fmt.Errorf("%s is not a number", n.Value)
+		}
+		return s, nil
+	case n.Type == Bool && c.BoolToNumber:
+		if n.Value == trueVal {
+			return "1", nil
+		}
+		return "0", nil
+	case n.Type == Null && c.NullAsZero:
+		return "0", nil
+	}
+	return "", &TypeError{Expected: c.accepted(Integer, Float, String, Bool), Actual: n.Type}
+}
+
+/* convert float text to integer, fraction is an error unless Lossy */
+func (c Coercion) toBigInt(text string) (*big.Int, error) {
+	f, _, err := big.ParseFloat(text, 10, uint(len(text))*4+64, big.ToNearestEven)
+	if err != nil {
+		return nil, err
+	}
+	/* avoid building huge integers like 1e1000000 */
+	if f.MantExp(nil) > 64 {
+		return nil, rangeError(text)
+	}
+	i, acc := f.Int(nil)
+	if acc != big.Exact && !c.Lossy {
+		return nil, lossyError(text, Integer)
+	}
+	return i, nil
+}
+
+/* accepted returns node types converted by rules from the candidates */
+func (c Coercion) accepted(types ...NodeType) []NodeType {
+	list := types[:1:1]
+	for _, t := range types[1:] {
+		switch {
+		case t == Integer || t == Float:
+			if types[0] != Bool || c.NumberToBool {
+				list = append(list, t)
+			}
+		case t == String && c.ParseStrings, t == Bool && c.BoolToNumber:
+			list = append(list, t)
+		}
+	}
+	if c.NullAsZero {
+		list = append(list, Null)
+	}
+	return list
+}
+
+func isIntegerText(text string) bool {
+	return !strings.ContainsAny(text, ".eE")
+}
+
+func rangeError(text string) error {
+	return &strconv.NumError{Func: "Coercion", Num: text, Err: strconv.ErrRange}
+}
+
+func lossyError(text string, target NodeType) error {
+	return fmt.Errorf("%w: %s to %s", ErrLossyConversion, text, target)
+}
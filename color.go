@@ -75,7 +75,7 @@ func (f *Formatter) processMap(m *Node, depth int) string {
 	nextIndent := f.generateIndent(depth)
 	rows := []string{}
 
-	if len(m.ObjectValues) == 0 {
+	if len(m.expand().ObjectValues) == 0 {
 		return "{}"
 	}
 
@@ -106,7 +106,7 @@ func (f *Formatter) processArray(a *Node, depth int) string {
 	nextIndent := f.generateIndent(depth)
 	rows := []string{}
 
-	if len(a.ArrayValues) == 0 {
+	if len(a.expand().ArrayValues) == 0 {
 		return "[]"
 	}
 
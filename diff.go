@@ -28,7 +28,7 @@ func (t DiffType) String() string {
 
 func Diff(t1, t2 *JSONTree) DiffItems {
 	d := &differ{}
-	d.diffNode(t1.Root, t2.Root, "")
+	d.diffNode(t1.Root, t2.Root, nil)
 	return d.diffList
 }
 
@@ -57,36 +57,74 @@ func (item DiffItem) String() string {
 
 type differ struct {
 	diffList []DiffItem
+	stack    []diffFrame
 }
 
-func (d *differ) diffNode(n1, n2 *Node, prefix string) {
-	if n1.Type != n2.Type {
-		d.addDiff(DiffOfType, prefix, n1, n2)
-		return
+/* node pair waiting to be compared */
+type diffFrame struct {
+	n1, n2 *Node
+	prefix *diffPath
+}
+
+/* diffPath is a path segment linked to its parent, the path string is built only when diff found */
+type diffPath struct {
+	parent *diffPath
+	name   string
+}
+
+func (p *diffPath) String() string {
+	var names []string
+	for ; p != nil; p = p.parent {
+		names = append(names, p.name)
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
 	}
-	switch n1.Type {
-	case String, Bool, Integer, Float:
-		if n1.Value != n2.Value {
-			d.addDiff(DiffOfValue, prefix, n1, n2)
+	return strings.Join(names, ".")
+}
+
+/* diffNode compare nodes with an explicit stack, so that deep nesting won't grow goroutine stack */
+func (d *differ) diffNode(n1, n2 *Node, prefix *diffPath) {
+	d.pushNode(n1, n2, prefix)
+	for len(d.stack) > 0 {
+		frame := d.stack[len(d.stack)-1]
+		d.stack = d.stack[:len(d.stack)-1]
+		n1, n2, prefix := frame.n1, frame.n2, frame.prefix
+		if n1.Type != n2.Type {
+			d.addDiff(DiffOfType, prefix, n1, n2)
+			continue
+		}
+		switch n1.Type {
+		case String, Bool, Integer, Float:
+			if n1.Value != n2.Value {
+				d.addDiff(DiffOfValue, prefix, n1, n2)
+			}
+		case Object:
+			d.diffObject(n1, n2, prefix)
+		case Array:
+			d.diffArray(n1, n2, prefix)
 		}
-	case Object:
-		d.diffObject(n1, n2, prefix)
-	case Array:
-		d.diffArray(n1, n2, prefix)
 	}
 }
 
-func (d *differ) diffArray(n1, n2 *Node, prefix string) {
+func (d *differ) pushNode(n1, n2 *Node, prefix *diffPath) {
+	d.stack = append(d.stack, diffFrame{n1: n1, n2: n2, prefix: prefix})
+}
+
+func (d *differ) diffArray(n1, n2 *Node, prefix *diffPath) {
+	n1.expand()
+	n2.expand()
 	if len(n1.ArrayValues) != len(n2.ArrayValues) {
 		d.addDiff(DiffOfValue, prefix, n1, n2)
 		return
 	}
-	for i, item := range n1.ArrayValues {
-		d.diffNode(item, n2.ArrayValues[i], d.appendPath(prefix, strconv.Itoa(i)))
+	/* push in reverse order to report diffs by index order */
+	for i := len(n1.ArrayValues) - 1; i >= 0; i-- {
+		d.pushNode(n1.ArrayValues[i], n2.ArrayValues[i], d.appendPath(prefix, strconv.Itoa(i)))
 	}
 }
 
-func (d *differ) diffObject(n1, n2 *Node, prefix string) {
+func (d *differ) diffObject(n1, n2 *Node, prefix *diffPath) {
 	left, right := n1.AsMap(), n2.AsMap()
 	for k, v := range left {
 		v2, ok := right[k]
@@ -94,7 +132,7 @@ func (d *differ) diffObject(n1, n2 *Node, prefix string) {
 			d.addDiff(DiffOfValue, d.appendPath(prefix, k), v, nil)
 			continue
 		}
-		d.diffNode(v, v2, d.appendPath(prefix, k))
+		d.pushNode(v, v2, d.appendPath(prefix, k))
 		delete(right, k)
 	}
 	for k, v := range right {
@@ -103,18 +141,15 @@ func (d *differ) diffObject(n1, n2 *Node, prefix string) {
 			d.addDiff(DiffOfValue, d.appendPath(prefix, k), nil, v)
 			continue
 		}
-		d.diffNode(v, v2, d.appendPath(prefix, k))
+		d.pushNode(v, v2, d.appendPath(prefix, k))
 	}
 }
 
-func (d *differ) appendPath(prefix string, suffix ...string) string {
-	if len(suffix) > 0 {
-		return prefix + "." + strings.Join(suffix, ".")
-	}
-	return prefix
+func (d *differ) appendPath(prefix *diffPath, name string) *diffPath {
+	return &diffPath{parent: prefix, name: name}
 }
 
-func (d *differ) addDiff(t DiffType, prefix string, ln, rn *Node) {
+func (d *differ) addDiff(t DiffType, prefix *diffPath, ln, rn *Node) {
 	lv, rv := undefined, undefined
 	if ln != nil {
 		lv = ln.AsJSON()
@@ -122,5 +157,5 @@ func (d *differ) addDiff(t DiffType, prefix string, ln, rn *Node) {
 	if rn != nil {
 		rv = rn.AsJSON()
 	}
-	d.diffList = append(d.diffList, DiffItem{Type: t, Path: strings.TrimPrefix(prefix, "."), Left: lv, Right: rv})
+	d.diffList = append(d.diffList, DiffItem{Type: t, Path: prefix.String(), Left: lv, Right: rv})
 }
@@ -0,0 +1,80 @@
+package qjson
+
+import "bytes"
+
+// DuplicateKeys decide how to decode an object having the same key more than once,
+// keys are compared after unescaping, so "a" and "\u0061" are the same key.
+type DuplicateKeys byte
+
+const (
+	// DuplicateKeysKeepAll keeps every element, lookups by key like Find see the first one,
+	// while AsMap, Equal and Diff see the last one. It's the default.
+	DuplicateKeysKeepAll DuplicateKeys = iota
+	// DuplicateKeysError fails decoding with DuplicateKeyError
+	DuplicateKeysError
+	// DuplicateKeysKeepFirst keeps the first element and drops later ones
+	DuplicateKeysKeepFirst
+	// DuplicateKeysKeepLast keeps value of the last element at the place of the first one
+	DuplicateKeysKeepLast
+)
+
+func (k DuplicateKeys) String() string {
+	switch k {
+	case DuplicateKeysKeepAll:
+		return "KeepAll"
+	case DuplicateKeysError:
+		return "Error"
+	case DuplicateKeysKeepFirst:
+		return "KeepFirst"
+	case DuplicateKeysKeepLast:
+		return "KeepLast"
+	default:
+		return ""
+	}
+}
+
+/* dropDuplicates tell duplicate elements are dropped from decoded objects */
+func (k DuplicateKeys) dropDuplicates() bool {
+	return k == DuplicateKeysKeepFirst || k == DuplicateKeysKeepLast
+}
+
+/* check key just scanned in frame, set s.dupIndex to index of the kept element with the same key or -1 */
+func (s *Scanner) checkDuplicateKey(frame *scanFrame, tok Token) error {
+	s.dupIndex = -1
+	depth := len(s.stack) - 1
+	for len(s.keySets) <= depth {
+		s.keySets = append(s.keySets, nil)
+	}
+	/* key sets are reused by objects at the same depth */
+	keys := s.keySets[depth]
+	if keys == nil {
+		keys = make(map[string]int)
+		s.keySets[depth] = keys
+	} else if frame.count == 1 {
+		for k := range keys {
+			delete(keys, k)
+		}
+	}
+	key := s.keyString(tok.Raw)
+	index, ok := keys[key]
+	if !ok {
+		keys[key] = len(keys)
+		return nil
+	}
+	if s.opts.DuplicateKeys == DuplicateKeysError {
+		return &DuplicateKeyError{Key: key, Path: s.path(len(s.stack)), Offset: tok.Offset}
+	}
+	s.dupIndex = index
+	return nil
+}
+
+/* keyString returns unescaped key, plain key aliases input */
+func (s *Scanner) keyString(raw []byte) string {
+	if raw[0] == quote && bytes.IndexByte(raw, escapeChar) < 0 {
+		return bytesToString(raw[1 : len(raw)-1])
+	}
+	if key, ok := s.unquoteKey(raw); ok {
+		return string(key)
+	}
+	return bytesToString(raw)
+}
@@ -0,0 +1,141 @@
+package qjson
+
+import (
+	"bytes"
+	"encoding/binary"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// InvalidUTF8 decide how to decode strings having invalid UTF-8
+type InvalidUTF8 byte
+
+const (
+	// InvalidUTF8Keep keeps invalid bytes as they are, it's the default
+	InvalidUTF8Keep InvalidUTF8 = iota
+	// InvalidUTF8Error fails decoding with SyntaxError
+	InvalidUTF8Error
+	// InvalidUTF8Replace replaces every invalid byte with U+FFFD like encoding/json
+	InvalidUTF8Replace
+)
+
+func (u InvalidUTF8) String() string {
+	switch u {
+	case InvalidUTF8Keep:
+		return "Keep"
+	case InvalidUTF8Error:
+		return "Error"
+	case InvalidUTF8Replace:
+		return "Replace"
+	default:
+		return ""
+	}
+}
+
+var (
+	bomUTF8     = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16BE  = []byte{0xFE, 0xFF}
+	bomUTF16LE  = []byte{0xFF, 0xFE}
+	bomUTF32BE  = []byte{0x00, 0x00, 0xFE, 0xFF}
+	bomUTF32LE  = []byte{0xFF, 0xFE, 0x00, 0x00}
+	replacement = []byte(string(utf8.RuneError))
+)
+
+/* transcodeInput drop UTF-8 BOM, and transcode UTF-16/UTF-32 input into UTF-8 */
+func transcodeInput(data []byte) []byte {
+	/* without BOM, encoding is told by null bytes since json text always begins with an ASCII char */
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return data[len(bomUTF8):]
+	case bytes.HasPrefix(data, bomUTF32LE):
+		return decodeUTF32(data[len(bomUTF32LE):], binary.LittleEndian)
+	case bytes.HasPrefix(data, bomUTF32BE):
+		return decodeUTF32(data[len(bomUTF32BE):], binary.BigEndian)
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return decodeUTF16(data[len(bomUTF16LE):], binary.LittleEndian)
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return decodeUTF16(data[len(bomUTF16BE):], binary.BigEndian)
+	case len(data) >= 4 && data[0] == 0 && data[1] == 0 && data[2] == 0:
+		return decodeUTF32(data, binary.BigEndian)
+	case len(data) >= 4 && data[1] == 0 && data[2] == 0 && data[3] == 0:
+		return decodeUTF32(data, binary.LittleEndian)
+	case len(data) >= 2 && data[0] == 0:
+		return decodeUTF16(data, binary.BigEndian)
+	case len(data) >= 2 && data[1] == 0:
+		return decodeUTF16(data, binary.LittleEndian)
+	}
+	return data
+}
+
+/* invalid code units are replaced with U+FFFD */
+func decodeUTF16(data []byte, order binary.ByteOrder) []byte {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, len(units)))
+	for _, r := range utf16.Decode(units) {
+		buf.WriteRune(r)
+	}
+	if len(data)%2 != 0 {
+		buf.Write(replacement)
+	}
+	return buf.Bytes()
+}
+
+func decodeUTF32(data []byte, order binary.ByteOrder) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, len(data)/4))
+	for i := 0; i+4 <= len(data); i += 4 {
+		buf.WriteRune(rune(order.Uint32(data[i:])))
+	}
+	if len(data)%4 != 0 {
+		buf.Write(replacement)
+	}
+	return buf.Bytes()
+}
+
+/* checkString check string token against MaxStringLen and InvalidUTF8 */
+func (s *Scanner) checkString(tok *Token) error {
+	if err := s.checkStringLen(*tok); err != nil {
+		return err
+	}
+	switch s.opts.InvalidUTF8 {
+	case InvalidUTF8Error:
+		if i := invalidUTF8Index(tok.Raw); i >= 0 {
+			return newSyntaxError(s.data, tok.Offset+i, expectValidUTF8)
+		}
+	case InvalidUTF8Replace:
+		tok.invalidUTF8 = !utf8.Valid(tok.Raw)
+	}
+	return nil
+}
+
+/* return index of the first invalid UTF-8 byte, or -1 if all valid */
+func invalidUTF8Index(data []byte) int {
+	if utf8.Valid(data) {
+		return -1
+	}
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i
+		}
+		i += size
+	}
+	return -1
+}
+
+/* replace every invalid byte with U+FFFD */
+func replaceInvalidUTF8(data []byte) string {
+	buf := make([]byte, 0, len(data)+2*len(replacement))
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, replacement...)
+		} else {
+			buf = append(buf, data[i:i+size]...)
+		}
+		i += size
+	}
+	return bytesToString(buf)
+}
@@ -0,0 +1,184 @@
+package qjson
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	excerptRadius = 20
+	ellipsis      = "..."
+)
+
+/* expected token kinds reported by SyntaxError */
+const (
+	expectValue       = "value"
+	expectObjectKey   = "object key or '}'"
+	expectColon       = "':'"
+	expectObjectValue = "object value"
+	expectArrayValue  = "array value or ']'"
+	expectEnd         = "end of input"
+)
+
+// SyntaxError describe where and why json decoding failed
+type SyntaxError struct {
+	// Msg describe what was found, e.g. unexpected char 'x'
+	Msg string
+	// Expect is the token kind the decoder was looking for
+	Expect string
+	// Offset is the byte offset of the bad char in input
+	Offset int
+	// Line and Column are 1-based, Column counts runes
+	Line   int
+	Column int
+	// Excerpt is a short piece of the bad line followed by a caret line
+	Excerpt string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d (offset %d), expect %s", e.Msg, e.Line, e.Column, e.Offset, e.Expect)
+}
+
+/* names of DecodeOptions limits reported by LimitError */
+const (
+	limitMaxDepth      = "MaxDepth"
+	limitMaxInputBytes = "MaxInputBytes"
+	limitMaxArrayLen   = "MaxArrayLen"
+	limitMaxObjectKeys = "MaxObjectKeys"
+	limitMaxStringLen  = "MaxStringLen"
+)
+
+// LimitError describe which limit of DecodeOptions is exceeded by input
+type LimitError struct {
+	// Limit is the name of option, e.g. MaxDepth
+	Limit string
+	// Max is the value of option
+	Max int
+	// Path of the value exceeding limit, in the syntax of JSONTree.Find
+	Path string
+	// Offset of the value exceeding limit in input
+	Offset int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s %d exceeded at path %q (offset %d)", e.Limit, e.Max, e.Path, e.Offset)
+}
+
+// DuplicateKeyError is returned when an object has duplicate keys and DecodeOptions.DuplicateKeys is DuplicateKeysError
+type DuplicateKeyError struct {
+	// Key is the unescaped key
+	Key string
+	// Path of the duplicate element, in the syntax of JSONTree.Find
+	Path string
+	// Offset of the duplicate key in input
+	Offset int
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("duplicate key %q at path %q (offset %d)", e.Key, e.Path, e.Offset)
+}
+
+// TypeError is returned by accessors when node type is not the expected one
+type TypeError struct {
+	// Path of the node in the syntax of JSONTree.Find, it's empty for accessors of Node
+	Path string
+	// Expected node types, any of them is accepted
+	Expected []NodeType
+	// Actual node type
+	Actual NodeType
+}
+
+func (e *TypeError) Error() string {
+	names := make([]string, len(e.Expected))
+	for i, t := range e.Expected {
+		names[i] = t.String()
+	}
+	if e.Path == "" {
+		return fmt.Sprintf("node type is %s, expect %s", e.Actual, strings.Join(names, " or "))
+	}
+	return fmt.Sprintf("node type at path %q is %s, expect %s", e.Path, e.Actual, strings.Join(names, " or "))
+}
+
+// NotFoundError is returned by path getters of JSONTree when nothing found by path
+type NotFoundError struct {
+	Path string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("no node found at path %q", e.Path)
+}
+
+// SharedNodeError is returned by JSONTree.CheckShared when a node is reachable from two parents
+type SharedNodeError struct {
+	// Path and OtherPath of the shared node, in the syntax of JSONTree.Find
+	Path      string
+	OtherPath string
+}
+
+func (e *SharedNodeError) Error() string {
+	return fmt.Sprintf("node at path %q is shared with path %q", e.OtherPath, e.Path)
+}
+
+/* build syntax error for char at offset, offset may equal len(jsonBytes) which means end of input */
+func newSyntaxError(jsonBytes []byte, offset int, expect string) *SyntaxError {
+	if offset > len(jsonBytes) {
+		offset = len(jsonBytes)
+	}
+	err := &SyntaxError{Expect: expect, Offset: offset}
+	if offset == len(jsonBytes) {
+		err.Msg = "unexpected end of input"
+	} else if r, _ := utf8.DecodeRune(jsonBytes[offset:]); r != utf8.RuneError {
+		err.Msg = fmt.Sprintf("unexpected char %q", r)
+	} else {
+		err.Msg = fmt.Sprintf("unexpected byte 0x%02x", jsonBytes[offset])
+	}
+	lineStart := bytes.LastIndexByte(jsonBytes[:offset], '\n') + 1
+	err.Line = bytes.Count(jsonBytes[:lineStart], []byte{'\n'}) + 1
+	err.Column = utf8.RuneCount(jsonBytes[lineStart:offset]) + 1
+	err.Excerpt = makeExcerpt(jsonBytes, lineStart, offset)
+	return err
+}
+
+/* cut at most excerptRadius bytes around offset in the same line, and put a caret under offset */
+func makeExcerpt(jsonBytes []byte, lineStart, offset int) string {
+	lineEnd := len(jsonBytes)
+	if idx := bytes.IndexByte(jsonBytes[offset:], '\n'); idx >= 0 {
+		lineEnd = offset + idx
+	}
+	from, to := lineStart, lineEnd
+	var prefix, suffix string
+	if offset-from > excerptRadius {
+		from = offset - excerptRadius
+		for from < offset && !utf8.RuneStart(jsonBytes[from]) {
+			from++
+		}
+		prefix = ellipsis
+	}
+	if to-offset > excerptRadius {
+		to = offset + excerptRadius
+		for to > offset && to < len(jsonBytes) && !utf8.RuneStart(jsonBytes[to]) {
+			to--
+		}
+		suffix = ellipsis
+	}
+	var sb strings.Builder
+	sb.WriteString(prefix)
+	writeExcerptBytes(&sb, jsonBytes[from:to])
+	sb.WriteString(suffix)
+	sb.WriteByte('\n')
+	sb.WriteString(strings.Repeat(" ", len(prefix)+utf8.RuneCount(jsonBytes[from:offset])))
+	sb.WriteByte('^')
+	return sb.String()
+}
+
+/* control chars would break the caret alignment, print them as space */
+func writeExcerptBytes(sb *strings.Builder, data []byte) {
+	for _, b := range data {
+		if b < ' ' {
+			b = ' '
+		}
+		sb.WriteByte(b)
+	}
+}
@@ -28,13 +28,14 @@ func (sp stPath) isArrayElemSelector() bool {
 	return sp.Name == "#"
 }
 
+/* index must fit in int, so that asInteger won't overflow */
 func (sp stPath) isInteger() bool {
-	_, err := strconv.ParseUint(sp.Name, 10, 64)
+	_, err := strconv.ParseUint(sp.Name, 10, strconv.IntSize-1)
 	return err == nil
 }
 
 func (sp stPath) asInteger() int {
-	i, _ := strconv.ParseUint(sp.Name, 10, 64)
+	i, _ := strconv.ParseUint(sp.Name, 10, strconv.IntSize-1)
 	return int(i)
 }
 
@@ -45,16 +46,15 @@ func findNode(node *Node, paths []stPath) *Node {
 	if node == nil {
 		return nil
 	}
+	node.expand()
 	p := paths[0]
 	switch node.Type {
 	case Null, String, Bool, Integer, Float:
 		/* should never come here */
 		return nil
 	case Object:
-		for _, n := range node.ObjectValues {
-			if n.Key.AsString() == p.Name {
-				return findNode(n.Value, paths[1:])
-			}
+		if i := node.objectIndexOf(p.Name); i >= 0 {
+			return findNode(node.ObjectValues[i].Value, paths[1:])
 		}
 	case Array:
 		if p.isArrayElemSelector() {
@@ -85,7 +85,7 @@ func filterArrayNodeBySelector(node *Node, path stPath) []*Node {
 	}
 	val := strings.TrimSuffix(strings.TrimPrefix(path.Val, `"`), `"`)
 	var list []*Node
-	for _, n := range node.ArrayValues {
+	for _, n := range node.expand().ArrayValues {
 		if out := findNode(n, paths); out != nil {
 			if isElemMatched(out, path.Op, val) {
 				list = append(list, n)
@@ -98,7 +98,7 @@ func filterArrayNodeBySelector(node *Node, path stPath) []*Node {
 func isElemMatched(n *Node, op string, val string) bool {
 	switch n.Type {
 	case Array:
-		for _, n := range n.ArrayValues {
+		for _, n := range n.expand().ArrayValues {
 			if isElemMatched(n, op, val) {
 				return true
 			}
@@ -115,67 +115,55 @@ func isElemMatched(n *Node, op string, val string) bool {
 			return v != val
 		case arrayElemNotContains:
 			return !strings.Contains(v, val)
-		case arrayElemGreaterThan:
-			if n.IsNumber() {
-				if strings.Contains(val, ".") || strings.Contains(n.AsString(), ".") {
-					if num, err := strconv.ParseFloat(val, 64); err == nil {
-						return n.AsFloat() > num
-					}
-				} else {
-					if num, err := strconv.ParseInt(val, 10, 64); err == nil {
-						return n.AsInt() > num
-					}
-				}
-			} else {
-				return n.AsString() > val
-			}
-		case arrayElemGreaterEqThan:
+		case arrayElemGreaterThan, arrayElemGreaterEqThan, arrayElemLessEqThan, arrayElemLessThan:
+			cmp := strings.Compare(v, val)
 			if n.IsNumber() {
-				if strings.Contains(val, ".") || strings.Contains(n.AsString(), ".") {
-					if num, err := strconv.ParseFloat(val, 64); err == nil {
-						return n.AsFloat() >= num
-					}
-				} else {
-					if num, err := strconv.ParseInt(val, 10, 64); err == nil {
-						return n.AsInt() >= num
-					}
+				var ok bool
+				if cmp, ok = compareNumber(n, val); !ok {
+					return false
 				}
-			} else {
-				return n.AsString() >= val
 			}
-		case arrayElemLessEqThan:
-			if n.IsNumber() {
-				if strings.Contains(val, ".") || strings.Contains(n.AsString(), ".") {
-					if num, err := strconv.ParseFloat(val, 64); err == nil {
-						return n.AsFloat() <= num
-					}
-				} else {
-					if num, err := strconv.ParseInt(val, 10, 64); err == nil {
-						return n.AsInt() <= num
-					}
-				}
-			} else {
-				return n.AsString() <= val
-			}
-		case arrayElemLessThan:
-			if n.IsNumber() {
-				if strings.Contains(val, ".") || strings.Contains(n.AsString(), ".") {
-					if num, err := strconv.ParseFloat(val, 64); err == nil {
-						return n.AsFloat() < num
-					}
-				} else {
-					if num, err := strconv.ParseInt(val, 10, 64); err == nil {
-						return n.AsInt() < num
-					}
-				}
-			} else {
-				return n.AsString() < val
+			switch op {
+			case arrayElemGreaterThan:
+				return cmp > 0
+			case arrayElemGreaterEqThan:
+				return cmp >= 0
+			case arrayElemLessEqThan:
+				return cmp <= 0
+			default:
+				return cmp < 0
 			}
 		}
 	}
 	return false
 }
 
+/* compare number node with number text, int64 values are compared exactly, ok is false if val is not a number */
+func compareNumber(n *Node, val string) (cmp int, ok bool) {
+	if n.Type == Integer && isIntegerText(val) {
+		x, err1 := strconv.ParseInt(n.Value, 10, 64)
+		y, err2 := strconv.ParseInt(val, 10, 64)
+		if err1 == nil && err2 == nil {
+			return compareOrdered(x < y, x > y), true
+		}
+	}
+	x, err1 := strconv.ParseFloat(n.Value, 64)
+	y, err2 := strconv.ParseFloat(val, 64)
+	if err1 != nil || err2 != nil {
+		return 0, false
+	}
+	return compareOrdered(x < y, x > y), true
+}
+
+func compareOrdered(less, greater bool) int {
+	if less {
+		return -1
+	} else if greater {
+		return 1
+	}
+	return 0
+}
+
 func makeStPath(p string) ([]stPath, bool) {
 	var paths []stPath
 	proj := map[byte]byte{
@@ -0,0 +1,121 @@
+package qjson
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Get find node by path in json bytes like JSONTree.Find, but only the matched value is decoded,
+// unrelated values are skipped without creating nodes. Input after the matched value is not validated.
+// Nil is returned if nothing found, the node aliases data like Decode.
+func Get(jsonBytes []byte, path string) (*Node, error) {
+	paths, ok := makeStPath(path)
+	if !ok {
+		return nil, fmt.Errorf("invalid path %q", path)
+	}
+	d := decodePool.Get().(*decodeState)
+	defer d.release()
+	return d.init(jsonBytes, DecodeOptions{}).get(paths)
+}
+
+func (d *decodeState) get(paths []stPath) (*Node, error) {
+	s := &d.scanner
+	tok, err := s.Next()
+	for ; err == nil; paths = paths[1:] {
+		if tok.Kind == 0 {
+			/* container ended before key or index found */
+			return nil, nil
+		}
+		/* array selectors need the whole array, so fall back to find in decoded array */
+		if len(paths) == 0 || (tok.Kind == TokenBeginArray && paths[0].isArrayElemSelector()) {
+			node, err := d.decodeValue(tok)
+			if err != nil {
+				return nil, err
+			}
+			return findNode(node, paths), nil
+		}
+		switch {
+		case tok.Kind == TokenBeginObject:
+			tok, err = d.seekKey(paths[0].Name)
+		case tok.Kind == TokenBeginArray && paths[0].isInteger():
+			tok, err = d.seekIndex(paths[0].asInteger())
+		default:
+			return nil, nil
+		}
+	}
+	if err == io.EOF {
+		return nil, nil
+	}
+	return nil, err
+}
+
+/* seek in object just begun, return first token of the value with key, or zero token if not found */
+func (d *decodeState) seekKey(name string) (Token, error) {
+	s := &d.scanner
+	for {
+		tok, err := s.Next()
+		if err != nil || tok.Kind == TokenEndObject {
+			return Token{}, err
+		}
+		matched := rawKeyEqual(tok.Raw, name)
+		if tok, err = s.Next(); err != nil || matched {
+			return tok, err
+		}
+		if err = d.skipValue(tok); err != nil {
+			return Token{}, err
+		}
+	}
+}
+
+/* seek in array just begun, return first token of the element at index, or zero token if not found */
+func (d *decodeState) seekIndex(index int) (Token, error) {
+	s := &d.scanner
+	for i := 0; ; i++ {
+		tok, err := s.Next()
+		if err != nil || tok.Kind == TokenEndArray {
+			return Token{}, err
+		}
+		if i == index {
+			return tok, nil
+		}
+		if err = d.skipValue(tok); err != nil {
+			return Token{}, err
+		}
+	}
+}
+
+func (d *decodeState) skipValue(tok Token) error {
+	if tok.Kind == TokenBeginObject || tok.Kind == TokenBeginArray {
+		return d.scanner.Skip()
+	}
+	return nil
+}
+
+/* build node of the value beginning with tok */
+func (d *decodeState) decodeValue(tok Token) (*Node, error) {
+	node := CreateNode()
+	if tok.Kind != TokenBeginObject && tok.Kind != TokenBeginArray {
+		fillScalarNode(node, tok)
+		return node, nil
+	}
+	if err := d.scanner.Skip(); err != nil {
+		return nil, err
+	}
+	span, opts := d.scanner.data[tok.Offset:d.scanner.offset], d.scanner.opts
+	return node, d.init(span, opts).decode(node)
+}
+
+/* compare raw key with name without unquoting if possible */
+func rawKeyEqual(raw []byte, name string) bool {
+	if raw[0] != quote {
+		/* number or bool key in lenient mode */
+		return bytesToString(raw) == name
+	}
+	body := raw[1 : len(raw)-1]
+	if bytes.IndexByte(body, escapeChar) < 0 {
+		return bytesToString(body) == name
+	}
+	key, ok := unquoteBytes(raw)
+	return ok && bytesToString(key) == name
+}
@@ -19,10 +19,41 @@ func (n *Node) Rehash() uint64 {
 	return n.hash()
 }
 
+/* hash node and offspring in post order with an explicit stack, children hash are ready when container is hashed */
 func (n *Node) hash() uint64 {
 	if n == nil {
 		return 0
 	}
+	type hashFrame struct {
+		node     *Node
+		expanded bool
+	}
+	stack := []hashFrame{{node: n}}
+	for len(stack) > 0 {
+		frame := &stack[len(stack)-1]
+		node := frame.node
+		if !frame.expanded && node != nil && (node.Type == Object || node.Type == Array) {
+			frame.expanded = true
+			node.expand()
+			for _, item := range node.ObjectValues {
+				stack = append(stack, hashFrame{node: item.Key}, hashFrame{node: item.Value})
+			}
+			for _, item := range node.ArrayValues {
+				stack = append(stack, hashFrame{node: item})
+			}
+			continue
+		}
+		stack = stack[:len(stack)-1]
+		node.hashNode()
+	}
+	return n.hashId
+}
+
+/* compute hash of node, hash of children should be computed already */
+func (n *Node) hashNode() {
+	if n == nil {
+		return
+	}
 	switch n.Type {
 	case Null:
 		n.hashId = 0
@@ -32,8 +63,8 @@ func (n *Node) hash() uint64 {
 		list := getStrSlice()
 		defer putStrSlice(list)
 		for _, item := range n.ObjectValues {
-			list.Str = append(list.Str, strconv.FormatUint(item.Key.hash(), 10)+":"+
-				strconv.FormatUint(item.Value.hash(), 10))
+			list.Str = append(list.Str, strconv.FormatUint(item.Key.hashValue(), 10)+":"+
+				strconv.FormatUint(item.Value.hashValue(), 10))
 		}
 		sort.Strings(list.Str)
 		n.hashId = bytesHash(stringToBytes(strings.Join(list.Str, ",")))
@@ -42,12 +73,18 @@ func (n *Node) hash() uint64 {
 		buf.Reset()
 		defer bytesPool.Put(buf)
 		for _, item := range n.ArrayValues {
-			buf.Write(stringToBytes(strconv.FormatUint(item.hash(), 10)))
+			buf.Write(stringToBytes(strconv.FormatUint(item.hashValue(), 10)))
 			buf.WriteByte(',')
 		}
 		n.hashId = bytesHash(buf.Bytes())
 	}
+}
 
+/* computed hash of node, nil node hash is 0 */
+func (n *Node) hashValue() uint64 {
+	if n == nil {
+		return 0
+	}
 	return n.hashId
 }
 
@@ -0,0 +1,416 @@
+package qjson
+
+import (
+	"bytes"
+	"math/big"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	singleQuote byte = '\''
+	slashChar   byte = '/'
+	plusChar    byte = '+'
+	infinityVal      = "Infinity"
+	nanVal           = "NaN"
+)
+
+var commentEnd = []byte("*/")
+
+/* expected token kinds only reported in JSON5 mode */
+const (
+	expectSingleQuote = `"'"`
+)
+
+/* search first valid char from offset, comments and unicode spaces are skipped too in JSON5 mode */
+func (s *Scanner) skipSpace(offset int) int {
+	if !s.opts.JSON5 {
+		return searchFirstValidChar(s.data, offset)
+	}
+	jsonBytes := s.data
+	for i := offset; i < len(jsonBytes); {
+		b := jsonBytes[i]
+		switch {
+		case nonsenseChars.Contains(b) || b == '\v' || b == '\f':
+			i++
+		case b == slashChar:
+			n := skipComment(jsonBytes[i:], true)
+			if n == 0 {
+				return i
+			}
+			i += n
+		case b >= utf8.RuneSelf:
+			r, size := utf8.DecodeRune(jsonBytes[i:])
+			if !isJSON5Space(r) {
+				return i
+			}
+			i += size
+		default:
+			return i
+		}
+	}
+	return -1
+}
+
+func isJSON5Space(r rune) bool {
+	return r == '\uFEFF' || r == '\u2028' || r == '\u2029' || unicode.Is(unicode.Zs, r)
+}
+
+/* return length of comment at the beginning of data, 0 if it's not a comment, -1 if more data needed */
+func skipComment(data []byte, atEOF bool) int {
+	if len(data) < 2 {
+		if atEOF || len(data) == 0 || data[0] != slashChar {
+			return 0
+		}
+		return -1
+	}
+	if data[0] != slashChar {
+		return 0
+	}
+	switch data[1] {
+	case slashChar:
+		if idx := bytes.IndexByte(data[2:], '\n'); idx >= 0 {
+			return idx + 3
+		}
+	case '*':
+		if idx := bytes.Index(data[2:], commentEnd); idx >= 0 {
+			return idx + 4
+		}
+	default:
+		return 0
+	}
+	/* comment not closed at EOF spans all data */
+	if atEOF {
+		return len(data)
+	}
+	return -1
+}
+
+/* scan string or number in JSON5 syntax, tokens not conforming to json are marked to be normalized */
+func (s *Scanner) scanJSON5Scalar(offset int, expect string) (Token, error) {
+	jsonBytes := s.data
+	kind := TokenNumber
+	var end int
+	var normalize bool
+	if b := jsonBytes[offset]; b == quote || b == singleQuote {
+		kind = TokenString
+		var errOffset int
+		if end, errOffset, normalize = scanJSON5String(jsonBytes, offset); errOffset >= 0 {
+			if b == quote {
+				return Token{}, newSyntaxError(jsonBytes, errOffset, expectQuote)
+			}
+			return Token{}, newSyntaxError(jsonBytes, errOffset, expectSingleQuote)
+		}
+	} else if end, normalize = scanJSON5Number(jsonBytes, offset); end < 0 {
+		return Token{}, newSyntaxError(jsonBytes, offset, expect)
+	}
+	tok := s.token(kind, offset, end)
+	tok.json5 = normalize
+	if kind == TokenString {
+		if err := s.checkString(&tok); err != nil {
+			return Token{}, err
+		}
+	}
+	s.done = len(s.stack) == 0
+	return tok, nil
+}
+
+/* key may be quoted string or identifier, or number in lenient mode */
+func (s *Scanner) scanJSON5Key(offset int) (Token, error) {
+	jsonBytes := s.data
+	switch b := jsonBytes[offset]; {
+	case b == quote || b == singleQuote:
+		return s.scanJSON5Scalar(offset, expectObjectKey)
+	case isIdentifierStart(jsonBytes[offset:]):
+		tok := s.token(TokenKey, offset, scanIdentifier(jsonBytes, offset))
+		tok.json5 = true
+		return tok, nil
+	case !s.opts.Strict && nextValueIsNumber(jsonBytes, offset):
+		return s.token(TokenKey, offset, scanNumber(jsonBytes, offset)), nil
+	}
+	if s.opts.Strict {
+		return Token{}, newSyntaxError(jsonBytes, offset, expectStringKey)
+	}
+	return Token{}, newSyntaxError(jsonBytes, offset, expectObjectKey)
+}
+
+/* errOffset is -1 if ok, string must be closed before line ends, normalize is true if string is single-quoted or has escapes unknown to json or raw control chars */
+func scanJSON5String(jsonBytes []byte, offset int) (end int, errOffset int, normalize bool) {
+	q := jsonBytes[offset]
+	normalize = q == singleQuote
+	for i := offset + 1; i < len(jsonBytes); i++ {
+		switch b := jsonBytes[i]; {
+		case b == escapeChar:
+			i++
+			if i < len(jsonBytes) && !isJSONEscapeChar(jsonBytes[i]) {
+				normalize = true
+			}
+			/* line continuation of CRLF */
+			if i+1 < len(jsonBytes) && jsonBytes[i] == '\r' && jsonBytes[i+1] == '\n' {
+				i++
+			}
+		case b == q:
+			return i + 1, -1, normalize
+		case b == '\n' || b == '\r':
+			return 0, i, false
+		case b < ' ':
+			/* json requires control chars to be escaped */
+			normalize = true
+		}
+	}
+	return 0, len(jsonBytes), false
+}
+
+func isJSONEscapeChar(b byte) bool {
+	switch b {
+	case '"', '\\', '/', 'b', 'f', 'n', 'r', 't', 'u':
+		return true
+	}
+	return false
+}
+
+/* return -1 if no number at offset, normalize is true if number is not in json syntax */
+func scanJSON5Number(jsonBytes []byte, offset int) (end int, normalize bool) {
+	i := offset
+	if b := jsonBytes[i]; b == plusChar || b == negativeChar {
+		normalize = b == plusChar
+		i++
+	}
+	rest := bytesToString(jsonBytes[i:])
+	switch {
+	case strings.HasPrefix(rest, infinityVal):
+		return i + len(infinityVal), true
+	case strings.HasPrefix(rest, nanVal):
+		return i + len(nanVal), true
+	case len(rest) > 2 && rest[0] == '0' && (rest[1] == 'x' || rest[1] == 'X') && isHexChar(rest[2]):
+		for i += 2; i < len(jsonBytes) && isHexChar(jsonBytes[i]); i++ {
+		}
+		return i, true
+	}
+	start := i
+	i = skipDigits(jsonBytes, i)
+	hasInt := i > start
+	if i < len(jsonBytes) && jsonBytes[i] == dotChar {
+		fracStart := i + 1
+		i = skipDigits(jsonBytes, fracStart)
+		if !hasInt && i == fracStart {
+			return -1, false
+		}
+		/* leading or trailing decimal point */
+		normalize = normalize || !hasInt || i == fracStart
+	} else if !hasInt {
+		return -1, false
+	}
+	if i < len(jsonBytes) && (jsonBytes[i] == scientificNotationLower || jsonBytes[i] == scientificNotationUpper) {
+		j := i + 1
+		if j < len(jsonBytes) && (jsonBytes[j] == scientificNotationPlus || jsonBytes[j] == scientificNotationMinus) {
+			j++
+		}
+		if k := skipDigits(jsonBytes, j); k > j {
+			i = k
+		}
+	}
+	return i, normalize
+}
+
+func isIdentifierStart(data []byte) bool {
+	if b := data[0]; b < utf8.RuneSelf {
+		return b == '_' || b == '$' || (b|0x20 >= 'a' && b|0x20 <= 'z')
+	}
+	r, _ := utf8.DecodeRune(data)
+	return unicode.IsLetter(r)
+}
+
+func scanIdentifier(jsonBytes []byte, offset int) int {
+	for offset < len(jsonBytes) {
+		b := jsonBytes[offset]
+		if b < utf8.RuneSelf {
+			if b != '_' && b != '$' && !isIntegerChar(b) && !(b|0x20 >= 'a' && b|0x20 <= 'z') {
+				break
+			}
+			offset++
+			continue
+		}
+		r, size := utf8.DecodeRune(jsonBytes[offset:])
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) && !unicode.Is(unicode.Pc, r) {
+			break
+		}
+		offset += size
+	}
+	return offset
+}
+
+/* isNonFinite tells float value or JSON5 number token is +/-Infinity or NaN, json numbers and hex numbers never end with 'y' or 'N' */
+func isNonFinite(v string) bool {
+	if n := len(v); n == 0 || (v[n-1] != 'y' && v[n-1] != 'N') {
+		return false
+	}
+	return strings.HasSuffix(v, infinityVal) || strings.HasSuffix(v, nanVal)
+}
+
+/* fill node with token in JSON5 syntax */
+func fillJSON5Node(node *Node, tok Token) {
+	if tok.Kind != TokenNumber {
+		node.Type = String
+		node.Value = normalizeJSON5String(tok.Raw)
+		return
+	}
+	node.Value = normalizeJSON5Number(tok.Raw)
+	if isNonFinite(node.Value) {
+		node.Type = Float
+	} else {
+		fillNumberNode(node, []byte(node.Value))
+	}
+}
+
+/* writeNormalizedToken write token as standard json text */
+func writeNormalizedToken(buf *bytes.Buffer, tok Token) {
+	if tok.invalidUTF8 && !tok.json5 {
+		buf.WriteString(replaceInvalidUTF8(tok.Raw))
+	} else if !tok.json5 {
+		buf.Write(tok.Raw)
+	} else if tok.Kind == TokenNumber && isNonFinite(bytesToString(tok.Raw)) {
+		buf.WriteString(nullVal)
+	} else if tok.Kind == TokenNumber {
+		buf.WriteString(normalizeJSON5Number(tok.Raw))
+	} else {
+		buf.WriteString(normalizeJSON5String(tok.Raw))
+	}
+}
+
+/* convert JSON5 string or identifier into double-quoted json string */
+func normalizeJSON5String(raw []byte) string {
+	str, _ := unquoteJSON5(raw)
+	return string(stdMarshalString(str))
+}
+
+/* infinity and NaN keep JSON5 syntax since json has no way to express them, they are marshaled as null */
+func normalizeJSON5Number(raw []byte) string {
+	s := string(raw)
+	neg := s[0] == negativeChar
+	if s[0] == negativeChar || s[0] == plusChar {
+		s = s[1:]
+	}
+	var sb strings.Builder
+	if neg && s != nanVal {
+		sb.WriteByte(negativeChar)
+	}
+	switch {
+	case s == infinityVal || s == nanVal:
+		sb.WriteString(s)
+	case len(s) > 1 && (s[1] == 'x' || s[1] == 'X'):
+		n, _ := new(big.Int).SetString(s[2:], 16)
+		if neg && n.Sign() == 0 {
+			return n.String()
+		}
+		sb.WriteString(n.String())
+	default:
+		if s[0] == dotChar {
+			sb.WriteByte('0')
+		}
+		if dot := strings.IndexByte(s, dotChar); dot >= 0 && (dot+1 == len(s) || !isIntegerChar(s[dot+1])) {
+			sb.WriteString(s[:dot+1])
+			sb.WriteByte('0')
+			sb.WriteString(s[dot+1:])
+		} else {
+			sb.WriteString(s)
+		}
+	}
+	return sb.String()
+}
+
+/* unquoteJSON5 decode JSON5 string, identifier is returned as it is */
+func unquoteJSON5(raw []byte) ([]byte, bool) {
+	if len(raw) == 0 || (raw[0] != quote && raw[0] != singleQuote) {
+		return raw, true
+	}
+	if len(raw) < 2 || raw[len(raw)-1] != raw[0] {
+		return nil, false
+	}
+	body := raw[1 : len(raw)-1]
+	out := make([]byte, 0, len(body))
+	for i := 0; i < len(body); {
+		if body[i] != escapeChar {
+			out = append(out, body[i])
+			i++
+			continue
+		}
+		if i+1 >= len(body) {
+			return nil, false
+		}
+		c := body[i+1]
+		i += 2
+		switch c {
+		case 'b':
+			out = append(out, '\b')
+		case 'f':
+			out = append(out, '\f')
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case 'v':
+			out = append(out, '\v')
+		case '0':
+			out = append(out, 0)
+		case 'x':
+			if i+2 > len(body) || !isHexChar(body[i]) || !isHexChar(body[i+1]) {
+				return nil, false
+			}
+			out = appendRune(out, rune(hexValue(body[i])<<4|hexValue(body[i+1])))
+			i += 2
+		case 'u':
+			r := getu4(body[i-2:])
+			if r < 0 {
+				return nil, false
+			}
+			i += 4
+			if utf16.IsSurrogate(r) {
+				if r2 := getu4(body[i:]); utf16.DecodeRune(r, r2) != unicode.ReplacementChar {
+					r = utf16.DecodeRune(r, r2)
+					i += 6
+				} else {
+					r = unicode.ReplacementChar
+				}
+			}
+			out = appendRune(out, r)
+		case '\r':
+			/* line continuation */
+			if i < len(body) && body[i] == '\n' {
+				i++
+			}
+		case '\n':
+		default:
+			if c < utf8.RuneSelf {
+				out = append(out, c)
+				continue
+			}
+			r, size := utf8.DecodeRune(body[i-1:])
+			i += size - 1
+			if r != '\u2028' && r != '\u2029' {
+				out = appendRune(out, r)
+			}
+		}
+	}
+	return out, true
+}
+
+func appendRune(buf []byte, r rune) []byte {
+	var tmp [utf8.UTFMax]byte
+	n := utf8.EncodeRune(tmp[:], r)
+	return append(buf, tmp[:n]...)
+}
+
+func hexValue(b byte) byte {
+	switch {
+	case b >= 'a':
+		return b - 'a' + 10
+	case b >= 'A':
+		return b - 'A' + 10
+	}
+	return b - '0'
+}
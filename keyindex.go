@@ -0,0 +1,114 @@
+package qjson
+
+import (
+	"strings"
+	"sync/atomic"
+	"unsafe"
+)
+
+/* objects with fewer elements are scanned linearly, index costs more than it saves for them */
+const minIndexedKeys = 32
+
+/* keyIndex map key of object to index of the first element having it, it's built by the first lookup */
+type keyIndex struct {
+	keys map[string]int
+	/* ObjectValues the index is built for, index is stale once ObjectValues is resized or reallocated */
+	size  int
+	first **ObjectElem
+	last  *ObjectElem
+}
+
+func (idx *keyIndex) valid(values []*ObjectElem) bool {
+	return idx != nil && idx.size == len(values) && idx.size > 0 && idx.first == &values[0] && idx.last == values[len(values)-1]
+}
+
+/* index is published atomically, so that concurrent reads of a tree may build it */
+func (n *Node) loadIndex() *keyIndex {
+	if ext := n.loadExt(); ext != nil {
+		return (*keyIndex)(atomic.LoadPointer(&ext.index))
+	}
+	return nil
+}
+
+func (n *Node) storeIndex(idx *keyIndex) {
+	ext := n.loadExt()
+	if ext == nil && idx == nil {
+		return
+	} else if ext == nil {
+		ext = n.initExt(new(nodeExt))
+	}
+	atomic.StorePointer(&ext.index, unsafe.Pointer(idx))
+}
+
+func (n *Node) buildIndex(values []*ObjectElem) *keyIndex {
+	idx := &keyIndex{keys: make(map[string]int, len(values)), size: len(values), first: &values[0], last: values[len(values)-1]}
+	/* backwards so that the first element wins */
+	for i := len(values) - 1; i >= 0; i-- {
+		idx.keys[objectKey(values[i].Key)] = i
+	}
+	n.storeIndex(idx)
+	return idx
+}
+
+/* objectIndexOf returns index of the first element with key, or -1 if not found */
+func (n *Node) objectIndexOf(key string) int {
+	values := n.ObjectValues
+	if len(values) < minIndexedKeys {
+		for i, elem := range values {
+			if keyEqual(elem.Key, key) {
+				return i
+			}
+		}
+		return -1
+	}
+	idx := n.loadIndex()
+	if !idx.valid(values) {
+		idx = n.buildIndex(values)
+	}
+	if i, ok := idx.keys[key]; ok {
+		return i
+	}
+	return -1
+}
+
+// Reindex drop key index of object, it must be called after keys or elements of ObjectValues are modified in place,
+// e.g. by Key.SetString or ObjectValues[i] = elem. Appending to or reslicing ObjectValues is detected without it.
+func (n *Node) Reindex() {
+	n.storeIndex(nil)
+}
+
+/* append element to object and keep index valid */
+func (n *Node) appendObjectElem(elem *ObjectElem) {
+	idx := n.loadIndex()
+	valid := idx.valid(n.ObjectValues)
+	n.ObjectValues = append(n.ObjectValues, elem)
+	if !valid {
+		return
+	}
+	key := objectKey(elem.Key)
+	if _, ok := idx.keys[key]; !ok {
+		idx.keys[key] = len(n.ObjectValues) - 1
+	}
+	idx.size, idx.first, idx.last = len(n.ObjectValues), &n.ObjectValues[0], elem
+}
+
+/* objectKey returns unquoted key, plain string key aliases node value */
+func objectKey(k *Node) string {
+	if k.Type == String && len(k.Value) >= 2 && strings.IndexByte(k.Value, escapeChar) < 0 {
+		return k.Value[1 : len(k.Value)-1]
+	}
+	return k.AsString()
+}
+
+/* keyName returns unquoted key, nil key is empty */
+func keyName(k *Node) string {
+	if k == nil {
+		return emptyVal
+	}
+	return objectKey(k)
+}
+
+/* keyEqual compare key node with key, plain string key is compared without unquoting */
+func keyEqual(k *Node, key string) bool {
+	return objectKey(k) == key
+}
@@ -0,0 +1,119 @@
+package qjson
+
+import (
+	"bytes"
+	"io"
+)
+
+/* lazySpan keep raw bytes of a container which is not decoded yet */
+type lazySpan struct {
+	raw  []byte
+	opts *DecodeOptions
+}
+
+// Expand decode lazy node in place, only needed before accessing ObjectValues or ArrayValues directly
+// when tree is decoded with DecodeOptions.Lazy, children containers are still lazy after expanding.
+// Other node methods expand node automatically.
+func (n *Node) Expand() *Node {
+	return n.expand()
+}
+
+// ExpandAll decode lazy node and all offspring in place
+func (n *Node) ExpandAll() *Node {
+	stack := []*Node{n}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1].expand()
+		stack = stack[:len(stack)-1]
+		for _, elem := range node.ObjectValues {
+			stack = append(stack, elem.Value)
+		}
+		stack = append(stack, node.ArrayValues...)
+	}
+	return n
+}
+
+func (n *Node) expand() *Node {
+	if n == nil || n.lazy == nil {
+		return n
+	}
+	span := n.lazy
+	n.lazy = nil
+	d := decodePool.Get().(*decodeState)
+	defer d.release()
+	d.init(span.raw, *span.opts)
+	/* positions in span are relative to the container */
+	if pos := n.nodePos(); pos != nil {
+		d.pos.reset(*pos)
+	}
+	d.trivia.reset(false)
+	if err := d.decode(n); err != nil {
+		/* span has been validated when skipped */
+		panic(err)
+	}
+	return n
+}
+
+/* skip container just begun, keep it's raw bytes in node */
+func (d *decodeState) skipLazyNode(node *Node, tok Token) error {
+	if err := d.scanner.Skip(); err != nil {
+		return err
+	}
+	if d.lazyOpts == nil {
+		/* span is transcoded already */
+		opts := d.scanner.opts
+		opts.DetectEncoding = false
+		d.lazyOpts = &opts
+	}
+	node.lazy = &lazySpan{raw: d.scanner.data[tok.Offset:d.scanner.offset], opts: d.lazyOpts}
+	d.pos.end(node, d.scanner.offset)
+	return nil
+}
+
+/* write lazy container as compact json, output is the same as marshaling decoded nodes, or raw bytes in lossless mode */
+func lazyMarshalJSON(buf *bytes.Buffer, span *lazySpan) {
+	if span.opts.Lossless {
+		buf.Write(span.raw)
+		return
+	}
+	d := decodePool.Get().(*decodeState)
+	defer d.release()
+	if span.opts.DuplicateKeys.dropDuplicates() {
+		/* dropped elements can't be told from tokens, marshal the eagerly decoded node instead */
+		opts := *span.opts
+		opts.Lazy, opts.Positions = false, false
+		node := CreateNode()
+		if err := d.init(span.raw, opts).decode(node); err != nil {
+			panic(err)
+		}
+		nodeMarshalJSON(buf, node)
+		return
+	}
+	s := &d.init(span.raw, *span.opts).scanner
+	var needComma bool
+	for {
+		tok, err := s.next()
+		if err == io.EOF {
+			return
+		} else if err != nil {
+			panic(err)
+		}
+		switch tok.Kind {
+		case TokenEndObject, TokenEndArray:
+			buf.WriteByte(tok.Raw[0])
+			needComma = true
+		case TokenKey:
+			if needComma {
+				buf.WriteByte(commaChar)
+			}
+			writeNormalizedToken(buf, tok)
+			buf.WriteByte(colonChar)
+			needComma = false
+		default:
+			if needComma {
+				buf.WriteByte(commaChar)
+			}
+			writeNormalizedToken(buf, tok)
+			needComma = tok.Kind != TokenBeginObject && tok.Kind != TokenBeginArray
+		}
+	}
+}
@@ -0,0 +1,303 @@
+package qjson
+
+import (
+	"bytes"
+	"strings"
+)
+
+const maxTriviaChunk = 1024
+
+/* trivia keep source text around node decoded with DecodeOptions.Lossless */
+type trivia struct {
+	/* text after the separator or opening bracket before node, and text after node before the next separator */
+	before string
+	after  string
+	/* raw token text differs from normalized value, it's written as long as node value is not changed */
+	raw   string
+	value string
+	/* text before closing bracket of container, and the JSON5 trailing comma before it */
+	end           string
+	trailingComma bool
+}
+
+/* triviaTracker split text between tokens into trivia of nodes */
+type triviaTracker struct {
+	/* document is true if text before and after root value belongs to root */
+	document bool
+	end      int
+	/* prev is the last element of current container, text before next separator is after it */
+	prev *Node
+	buf  []trivia
+	exts extChunk
+}
+
+func (t *triviaTracker) reset(document bool) {
+	t.document, t.end, t.prev = document, 0, nil
+}
+
+/* alloc trivia of node, trivia are allocated in chunks */
+func (t *triviaTracker) alloc(node *Node) *trivia {
+	ext := t.exts.alloc(node)
+	if ext.trivia == nil {
+		if len(t.buf) == cap(t.buf) {
+			t.buf = make([]trivia, 0, min(maxTriviaChunk, 2*cap(t.buf)+8))
+		}
+		t.buf = append(t.buf, trivia{})
+		ext.trivia = &t.buf[len(t.buf)-1]
+	}
+	return ext.trivia
+}
+
+/* skipped drop text of a value skipped by decoder, node is the new last element if not nil */
+func (t *triviaTracker) skipped(node *Node, end int) {
+	if node != nil {
+		t.prev = node
+	}
+	t.end = end
+}
+
+/* record text before tok, node is the node made of tok, key is the key of node if it's an object value */
+func (d *decodeState) recordTrivia(node, key *Node, tok Token) {
+	t := &d.trivia
+	pre, post, sep := d.splitGap(tok.Offset)
+	switch tok.Kind {
+	case TokenEndObject, TokenEndArray:
+		if t.prev != nil {
+			t.prev.nodeTrivia().after = pre
+		}
+		tr := t.alloc(node)
+		tr.end, tr.trailingComma = post, sep
+		t.prev = node
+	case TokenKey:
+		if t.prev != nil {
+			t.prev.nodeTrivia().after = pre
+		}
+		t.alloc(node).before = post
+		d.recordRaw(node, tok)
+	default:
+		if key != nil {
+			key.nodeTrivia().after = pre
+		} else if t.prev != nil {
+			t.prev.nodeTrivia().after = pre
+		}
+		/* text around lazy container is kept by its parent */
+		if tr := t.alloc(node); len(d.stack) > 0 || t.document {
+			tr.before = post
+		}
+		d.recordRaw(node, tok)
+		t.prev = node
+		if tok.Kind == TokenBeginObject || tok.Kind == TokenBeginArray {
+			t.prev = nil
+		}
+	}
+	t.end = tok.Offset + len(tok.Raw)
+}
+
+func (d *decodeState) recordRaw(node *Node, tok Token) {
+	if tok.json5 || tok.invalidUTF8 {
+		tr := node.nodeTrivia()
+		tr.raw, tr.value = bytesToString(tok.Raw), node.Value
+	}
+}
+
+/* record text after root value */
+func (d *decodeState) finishTrivia(root *Node) {
+	if t := &d.trivia; t.document {
+		t.alloc(root).after = bytesToString(d.scanner.data[t.end:])
+	}
+}
+
+/* split text between last token and offset at the separator, sep is false if there's no separator */
+func (d *decodeState) splitGap(offset int) (pre, post string, sep bool) {
+	data, end := d.scanner.data, d.trivia.end
+	if i := d.scanner.skipSpace(end); i >= 0 && i < offset {
+		return bytesToString(data[end:i]), bytesToString(data[i+1 : offset]), true
+	}
+	return emptyVal, bytesToString(data[end:offset]), false
+}
+
+/* elemLayout is text around an element of lossless container */
+type elemLayout struct {
+	before      string
+	keyAfter    string
+	valueBefore string
+	after       string
+}
+
+/* container being written by losslessMarshalJSON, children are consumed from the head */
+type losslessFrame struct {
+	objectValues []*ObjectElem
+	arrayValues  []*Node
+	isObject     bool
+	started      bool
+	/* trivia of lossless container, and layout of the last element written */
+	trivia    *trivia
+	layout    elemLayout
+	hasLayout bool
+}
+
+/* losslessMarshalJSON write container decoded in lossless mode, offspring without trivia are written compactly */
+func losslessMarshalJSON(buf *bytes.Buffer, n *Node) {
+	var stack []losslessFrame
+	for {
+		switch {
+		case n.Type != Object && n.Type != Array:
+			scalarMarshalJSON(buf, n)
+		case n.lazy != nil:
+			lazyMarshalJSON(buf, n.lazy)
+		case n.Type == Object:
+			buf.WriteByte(objectStart)
+			stack = append(stack, losslessFrame{objectValues: n.ObjectValues, isObject: true, trivia: n.nodeTrivia()})
+		default:
+			buf.WriteByte(arrayStart)
+			stack = append(stack, losslessFrame{arrayValues: n.ArrayValues, trivia: n.nodeTrivia()})
+		}
+		/* pick next child to write, close finished containers */
+		for picked := false; !picked; {
+			if len(stack) == 0 {
+				return
+			}
+			frame := &stack[len(stack)-1]
+			if frame.isObject && len(frame.objectValues) > 0 {
+				elem := frame.objectValues[0]
+				if frame.trivia != nil {
+					writeLosslessElem(buf, stack, elem.Key, elem.Value)
+				} else {
+					if frame.started {
+						buf.WriteByte(commaChar)
+					}
+					scalarMarshalJSON(buf, elem.Key)
+					buf.WriteByte(colonChar)
+				}
+				frame.objectValues, frame.started = frame.objectValues[1:], true
+				n, picked = elem.Value, true
+			} else if len(frame.arrayValues) > 0 {
+				n, picked = frame.arrayValues[0], true
+				if frame.trivia != nil {
+					writeLosslessElem(buf, stack, nil, n)
+				} else if frame.started {
+					buf.WriteByte(commaChar)
+				}
+				frame.arrayValues, frame.started = frame.arrayValues[1:], true
+			} else {
+				if frame.trivia != nil {
+					writeLosslessEnd(buf, frame, frame.trivia)
+				}
+				if frame.isObject {
+					buf.WriteByte(objectEnd)
+				} else {
+					buf.WriteByte(arrayEnd)
+				}
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+}
+
+/* write separator and text before element of lossless container, key is nil for array element */
+func writeLosslessElem(buf *bytes.Buffer, stack []losslessFrame, key, value *Node) {
+	frame := &stack[len(stack)-1]
+	if frame.started {
+		buf.WriteString(frame.layout.after)
+		buf.WriteByte(commaChar)
+	}
+	if !frame.hasLayout {
+		frame.layout, frame.hasLayout = inferLayout(stack), true
+	}
+	/* elements without trivia copy whitespace of the previous sibling */
+	l := &frame.layout
+	valueTrivia := value.nodeTrivia()
+	if keyTrivia := key.nodeTrivia(); key != nil && keyTrivia != nil {
+		l.before, l.keyAfter = keyTrivia.before, keyTrivia.after
+		if valueTrivia != nil {
+			l.valueBefore, l.after = valueTrivia.before, valueTrivia.after
+		} else {
+			l.valueBefore, l.after = plainSpace(l.valueBefore), plainSpace(l.after)
+		}
+	} else if key == nil && valueTrivia != nil {
+		l.before, l.after = valueTrivia.before, valueTrivia.after
+	} else {
+		*l = elemLayout{before: plainSpace(l.before), keyAfter: plainSpace(l.keyAfter), valueBefore: plainSpace(l.valueBefore), after: plainSpace(l.after)}
+	}
+	buf.WriteString(l.before)
+	if key != nil {
+		scalarMarshalJSON(buf, key)
+		buf.WriteString(l.keyAfter)
+		buf.WriteByte(colonChar)
+		buf.WriteString(l.valueBefore)
+	}
+}
+
+/* write text before closing bracket of lossless container */
+func writeLosslessEnd(buf *bytes.Buffer, frame *losslessFrame, tr *trivia) {
+	if frame.started {
+		buf.WriteString(frame.layout.after)
+		if tr.trailingComma {
+			buf.WriteByte(commaChar)
+		}
+	}
+	buf.WriteString(tr.end)
+}
+
+/* inferLayout use the first sibling having trivia, or indent container's children one more level than container */
+func inferLayout(stack []losslessFrame) (l elemLayout) {
+	frame := &stack[len(stack)-1]
+	for _, elem := range frame.objectValues {
+		if kt, vt := elem.Key.nodeTrivia(), elem.Value.nodeTrivia(); kt != nil && vt != nil {
+			return elemLayout{before: kt.before, keyAfter: kt.after, valueBefore: vt.before, after: vt.after}
+		}
+	}
+	for _, elem := range frame.arrayValues {
+		if tr := elem.nodeTrivia(); tr != nil {
+			return elemLayout{before: tr.before, after: tr.after}
+		}
+	}
+	/* colon spacing is taken from the nearest object */
+	for i := len(stack) - 2; i >= 0; i-- {
+		if stack[i].isObject && stack[i].trivia != nil {
+			l.keyAfter, l.valueBefore = stack[i].layout.keyAfter, stack[i].layout.valueBefore
+			break
+		}
+	}
+	indent, ok := lastLine(frame.trivia.end)
+	if !ok {
+		return l
+	}
+	unit := "  "
+	if len(stack) > 1 && stack[len(stack)-2].trivia != nil {
+		parent := &stack[len(stack)-2]
+		childIndent, ok1 := lastLine(parent.layout.before)
+		parentIndent, ok2 := lastLine(parent.trivia.end)
+		if ok1 && ok2 && len(childIndent) > len(parentIndent) && strings.HasPrefix(childIndent, parentIndent) {
+			unit = childIndent[len(parentIndent):]
+		}
+	}
+	l.before = "\n" + indent + unit
+	return l
+}
+
+/* return text after the last line break */
+func lastLine(s string) (string, bool) {
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		return s[i+1:], true
+	}
+	return s, false
+}
+
+/* plainSpace drop comments from text between tokens, it keeps the last line break and indent after it, or leading spaces */
+func plainSpace(s string) string {
+	start := strings.LastIndexByte(s, '\n')
+	if start < 0 {
+		start = 0
+	} else if start > 0 && s[start-1] == '\r' {
+		start--
+	}
+	end := start
+	for end < len(s) && (s[end] == '\r' || s[end] == '\n') {
+		end++
+	}
+	for end < len(s) && (s[end] == ' ' || s[end] == '\t') {
+		end++
+	}
+	return s[start:end]
+}
@@ -3,8 +3,9 @@ package qjson
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"strconv"
+	"sync/atomic"
+	"unsafe"
 )
 
 // NodeType describe a json node type
@@ -27,16 +28,99 @@ const (
 	Array
 )
 
+func (t NodeType) String() string {
+	switch t {
+	case Null:
+		return "Null"
+	case String:
+		return "String"
+	case Bool:
+		return "Bool"
+	case Integer:
+		return "Integer"
+	case Float:
+		return "Float"
+	case Object:
+		return "Object"
+	case Array:
+		return "Array"
+	default:
+		return ""
+	}
+}
+
 // Color type
 type Color byte
 
-// Node represent json node
+// Node represent json node. Key lookups of big objects use an index kept up to date by node methods,
+// call Reindex after keys or elements of ObjectValues are modified in place.
 type Node struct {
 	Type         NodeType
 	Value        string
 	ObjectValues []*ObjectElem
 	ArrayValues  []*Node
 	hashId       uint64
+	lazy         *lazySpan
+	/* rarely used states, nil unless some option or big object needs them */
+	ext *nodeExt
+}
+
+/* nodeExt keep states of node needed by decode options or big objects, so that plain nodes stay small */
+type nodeExt struct {
+	pos    *Pos
+	trivia *trivia
+	/* *keyIndex of big object */
+	index unsafe.Pointer
+}
+
+/* ext is created by concurrent readers building key index, so it's loaded and set atomically */
+func (n *Node) loadExt() *nodeExt {
+	return (*nodeExt)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&n.ext))))
+}
+
+/* initExt set ext of node if it has none, the ext of node is returned */
+func (n *Node) initExt(ext *nodeExt) *nodeExt {
+	if atomic.CompareAndSwapPointer((*unsafe.Pointer)(unsafe.Pointer(&n.ext)), nil, unsafe.Pointer(ext)) {
+		return ext
+	}
+	return n.loadExt()
+}
+
+func (n *Node) nodePos() *Pos {
+	if n == nil {
+		return nil
+	}
+	if ext := n.loadExt(); ext != nil {
+		return ext.pos
+	}
+	return nil
+}
+
+func (n *Node) nodeTrivia() *trivia {
+	if n == nil {
+		return nil
+	}
+	if ext := n.loadExt(); ext != nil {
+		return ext.trivia
+	}
+	return nil
+}
+
+/* maxExtChunk limits size of ext chunk allocated by decoder */
+const maxExtChunk = 1024
+
+/* extChunk allocate ext of decoded nodes in chunks */
+type extChunk []nodeExt
+
+func (c *extChunk) alloc(node *Node) *nodeExt {
+	if ext := node.loadExt(); ext != nil {
+		return ext
+	}
+	if len(*c) == cap(*c) {
+		*c = make([]nodeExt, 0, min(maxExtChunk, 2*cap(*c)+8))
+	}
+	*c = append(*c, nodeExt{})
+	return node.initExt(&(*c)[len(*c)-1])
 }
 
 // ObjectElem represent an object
@@ -95,26 +179,34 @@ func (n *Node) Find(key string) *Node {
 
 // GetObjectElemByKey get object value by key
 func (n *Node) GetObjectElemByKey(key string) *ObjectElem {
-	if n.Type != Null && n.Type != Object {
-		panic("node type should be object")
-	}
-	for i, kv := range n.ObjectValues {
-		if kv.Key.AsString() == key {
-			return n.ObjectValues[i]
-		}
+	elem, err := n.TryGetObjectElemByKey(key)
+	if err != nil {
+		panic(err)
 	}
-	return nil
+	return elem
 }
 
 // RemoveObjectElemByKey remove object element
 func (n *Node) RemoveObjectElemByKey(key string) bool {
-	if n.Type != Null && n.Type != Object {
-		panic("node type should be object")
+	ok, err := n.TryRemoveObjectElemByKey(key)
+	if err != nil {
+		panic(err)
+	}
+	return ok
+}
+
+/* remove object elements by key, node type is checked by caller */
+func (n *Node) removeObjectElemByKey(key string) bool {
+	n.expand()
+	start := n.objectIndexOf(key)
+	if start < 0 {
+		return false
 	}
+	n.storeIndex(nil)
 	size := len(n.ObjectValues)
 	var delCnt int
-	for i := 0; i < size; i++ {
-		if n.ObjectValues[i].Key.AsString() == key {
+	for i := start; i < size; i++ {
+		if keyEqual(n.ObjectValues[i].Key, key) {
 			delCnt++
 		} else if delCnt > 0 {
 			n.ObjectValues[i-delCnt] = n.ObjectValues[i]
@@ -126,11 +218,61 @@ func (n *Node) RemoveObjectElemByKey(key string) bool {
 	return delCnt > 0
 }
 
+// InsertObjectElemBefore insert element before the first element having key, false is returned if key not found
+func (n *Node) InsertObjectElemBefore(key string, elem *ObjectElem) bool {
+	return n.insertObjectElem(key, elem, 0)
+}
+
+// InsertObjectElemAfter insert element after the first element having key, false is returned if key not found
+func (n *Node) InsertObjectElemAfter(key string, elem *ObjectElem) bool {
+	return n.insertObjectElem(key, elem, 1)
+}
+
+/* insert elem at offset from the element having key */
+func (n *Node) insertObjectElem(key string, elem *ObjectElem, offset int) bool {
+	if n.Type != Null && n.Type != Object {
+		panic("node type should be Object")
+	}
+	i := n.expand().objectIndexOf(key)
+	if i < 0 {
+		return false
+	}
+	i += offset
+	n.storeIndex(nil)
+	n.ObjectValues = append(n.ObjectValues, nil)
+	copy(n.ObjectValues[i+1:], n.ObjectValues[i:])
+	n.ObjectValues[i] = elem
+	return true
+}
+
+// RenameObjectKey rename key of the first element having oldKey and keep its position,
+// false is returned if oldKey not found or newKey exists already
+func (n *Node) RenameObjectKey(oldKey, newKey string) bool {
+	if n.Type != Null && n.Type != Object {
+		panic("node type should be Object")
+	}
+	i := n.expand().objectIndexOf(oldKey)
+	if i < 0 {
+		return false
+	} else if oldKey == newKey {
+		return true
+	} else if n.objectIndexOf(newKey) >= 0 {
+		return false
+	}
+	n.storeIndex(nil)
+	/* key may be number or bool decoded in lenient mode */
+	key := n.ObjectValues[i].Key
+	key.Type = String
+	key.SetString(newKey)
+	return true
+}
+
 // RemoveArrayElemByIndex remove array element
 func (n *Node) RemoveArrayElemByIndex(idx int) bool {
 	if n.Type != Null && n.Type != Array {
 		panic("node type should be Array")
 	}
+	n.expand()
 	size := len(n.ArrayValues)
 	if idx < 0 || idx >= size {
 		return false
@@ -142,125 +284,220 @@ func (n *Node) RemoveArrayElemByIndex(idx int) bool {
 	return true
 }
 
+// InsertArrayElem insert element at idx, elements from idx are moved backward, false is returned if idx is out of [0, len]
+func (n *Node) InsertArrayElem(idx int, elem *Node) bool {
+	if n.Type != Null && n.Type != Array {
+		panic("node type should be Array")
+	}
+	n.expand()
+	if idx < 0 || idx > len(n.ArrayValues) {
+		return false
+	}
+	n.ArrayValues = append(n.ArrayValues, nil)
+	copy(n.ArrayValues[idx+1:], n.ArrayValues[idx:])
+	n.ArrayValues[idx] = elem
+	return true
+}
+
+// Splice remove deleteCount elements from start and insert elems there, removed elements are returned.
+// start and deleteCount are clamped into array range.
+func (n *Node) Splice(start, deleteCount int, elems ...*Node) []*Node {
+	if n.Type != Null && n.Type != Array {
+		panic("node type should be Array")
+	}
+	n.expand()
+	size := len(n.ArrayValues)
+	if start < 0 {
+		start = 0
+	} else if start > size {
+		start = size
+	}
+	if deleteCount < 0 {
+		deleteCount = 0
+	} else if deleteCount > size-start {
+		deleteCount = size - start
+	}
+	removed := make([]*Node, deleteCount)
+	copy(removed, n.ArrayValues[start:])
+	values := make([]*Node, 0, size-deleteCount+len(elems))
+	values = append(values, n.ArrayValues[:start]...)
+	values = append(values, elems...)
+	n.ArrayValues = append(values, n.ArrayValues[start+deleteCount:]...)
+	return removed
+}
+
+// MoveArrayElem move element at from to index to, elements between them are shifted, false is returned if index is out of range
+func (n *Node) MoveArrayElem(from, to int) bool {
+	if n.Type != Null && n.Type != Array {
+		panic("node type should be Array")
+	}
+	n.expand()
+	size := len(n.ArrayValues)
+	if from < 0 || from >= size || to < 0 || to >= size {
+		return false
+	}
+	elem := n.ArrayValues[from]
+	if from < to {
+		copy(n.ArrayValues[from:], n.ArrayValues[from+1:to+1])
+	} else {
+		copy(n.ArrayValues[to+1:], n.ArrayValues[to:from])
+	}
+	n.ArrayValues[to] = elem
+	return true
+}
+
 func (n *Node) clearArray() {
 	if n.Type != Null && n.Type != Array {
 		panic("node type should be Array")
 	}
-	n.ArrayValues = nil
+	n.ArrayValues, n.lazy = nil, nil
 }
 
 // SetObjectStringElem set kv pair
 func (n *Node) SetObjectStringElem(key, value string) *Node {
-	for _, elem := range n.ObjectValues {
-		if elem.Key.AsString() == key {
-			elem.Value.Type = String
-			elem.Value.Value = bytesToString(stdMarshalString([]byte(value)))
-			return n
-		}
+	n.expand()
+	if i := n.objectIndexOf(key); i >= 0 {
+		elem := n.ObjectValues[i]
+		elem.Value.Type = String
+		elem.Value.Value = bytesToString(stdMarshalString([]byte(value)))
+		return n
 	}
 	elem := CreateObjectElem()
 	elem.Key = CreateStringNode()
 	elem.Key.Value = bytesToString(stdMarshalString([]byte(key)))
 	elem.Value = CreateStringNode()
 	elem.Value.Value = bytesToString(stdMarshalString([]byte(value)))
-	n.ObjectValues = append(n.ObjectValues, elem)
+	n.appendObjectElem(elem)
 	return n
 }
 
 // SetObjectIntElem set kv pair
 func (n *Node) SetObjectIntElem(key string, value int64) *Node {
-	for _, elem := range n.ObjectValues {
-		if elem.Key.AsString() == key {
-			elem.Value.Type = Integer
-			elem.Value.Value = strconv.FormatInt(value, 10)
-			return n
-		}
+	n.expand()
+	if i := n.objectIndexOf(key); i >= 0 {
+		elem := n.ObjectValues[i]
+		elem.Value.Type = Integer
+		elem.Value.Value = strconv.FormatInt(value, 10)
+		return n
 	}
 	elem := CreateObjectElem()
 	elem.Key = CreateStringNode()
 	elem.Key.Value = bytesToString(stdMarshalString([]byte(key)))
 	elem.Value = CreateIntegerNode()
 	elem.Value.Value = strconv.FormatInt(value, 10)
-	n.ObjectValues = append(n.ObjectValues, elem)
+	n.appendObjectElem(elem)
 	return n
 }
 
 // SetObjectUintElem set kv pair
 func (n *Node) SetObjectUintElem(key string, value uint64) *Node {
-	for _, elem := range n.ObjectValues {
-		if elem.Key.AsString() == key {
-			elem.Value.Type = Integer
-			elem.Value.Value = strconv.FormatUint(value, 10)
-			return n
-		}
+	n.expand()
+	if i := n.objectIndexOf(key); i >= 0 {
+		elem := n.ObjectValues[i]
+		elem.Value.Type = Integer
+		elem.Value.Value = strconv.FormatUint(value, 10)
+		return n
 	}
 	elem := CreateObjectElem()
 	elem.Key = CreateStringNode()
 	elem.Key.Value = bytesToString(stdMarshalString([]byte(key)))
 	elem.Value = CreateIntegerNode()
 	elem.Value.Value = strconv.FormatUint(value, 10)
-	n.ObjectValues = append(n.ObjectValues, elem)
+	n.appendObjectElem(elem)
 	return n
 }
 
 // SetObjectBoolElem set kv pair
 func (n *Node) SetObjectBoolElem(key string, value bool) *Node {
+	n.expand()
 	val := falseVal
 	if value {
 		val = trueVal
 	}
-	for _, elem := range n.ObjectValues {
-		if elem.Key.AsString() == key {
-			elem.Value.Type = Bool
-			elem.Value.Value = val
-			return n
-		}
+	if i := n.objectIndexOf(key); i >= 0 {
+		elem := n.ObjectValues[i]
+		elem.Value.Type = Bool
+		elem.Value.Value = val
+		return n
 	}
 	elem := CreateObjectElem()
 	elem.Key = CreateStringNode()
 	elem.Key.Value = bytesToString(stdMarshalString([]byte(key)))
 	elem.Value = CreateBoolNode()
 	elem.Value.Value = val
-	n.ObjectValues = append(n.ObjectValues, elem)
+	n.appendObjectElem(elem)
 	return n
 }
 
 // SetObjectNodeElem set kv pair
 func (n *Node) SetObjectNodeElem(key string, value *Node) *Node {
-	for _, elem := range n.ObjectValues {
-		if elem.Key.AsString() == key {
-			elem.Value = value
-			return n
-		}
+	n.expand()
+	if i := n.objectIndexOf(key); i >= 0 {
+		elem := n.ObjectValues[i]
+		elem.Value = value
+		return n
 	}
 	elem := CreateObjectElem()
 	elem.Key = CreateStringNode()
 	elem.Key.Value = bytesToString(stdMarshalString([]byte(key)))
 	elem.Value = value
-	n.ObjectValues = append(n.ObjectValues, elem)
+	n.appendObjectElem(elem)
 	return n
 }
 
+// SetObjectElem set kv pair, value is converted like ConvertToJSONTree, e.g. SetObjectElem("tags", []string{"a"}).
+// Null node becomes an object, error is returned if node is neither object nor null or value can't be converted.
+func (n *Node) SetObjectElem(key string, value interface{}) error {
+	if n.Type != Null && n.Type != Object {
+		return &TypeError{Expected: []NodeType{Object, Null}, Actual: n.Type}
+	}
+	node, err := converterInst.toNode(value)
+	if err != nil {
+		return err
+	}
+	if n.Type == Null {
+		n.Value, n.Type = emptyVal, Object
+	}
+	n.SetObjectNodeElem(key, node)
+	return nil
+}
+
 // AddObjectElem to node
 func (n *Node) AddObjectElem(elem *ObjectElem) *Node {
-	n.ObjectValues = append(n.ObjectValues, elem)
+	n.expand()
+	n.appendObjectElem(elem)
 	return n
 }
 
 // AddArrayElem to node
 func (n *Node) AddArrayElem(elem *Node) *Node {
+	n.expand()
 	n.ArrayValues = append(n.ArrayValues, elem)
 	return n
 }
 
+// AddArrayValue append value to array, value is converted like ConvertToJSONTree.
+// Null node becomes an array, error is returned if node is neither array nor null or value can't be converted.
+func (n *Node) AddArrayValue(value interface{}) error {
+	if n.Type != Null && n.Type != Array {
+		return &TypeError{Expected: []NodeType{Array, Null}, Actual: n.Type}
+	}
+	node, err := converterInst.toNode(value)
+	if err != nil {
+		return err
+	}
+	if n.Type == Null {
+		n.Value, n.Type = emptyVal, Array
+	}
+	n.AddArrayElem(node)
+	return nil
+}
+
 // AsMap create map for children
 func (n *Node) AsMap() map[string]*Node {
-	if n.Type != Null && n.Type != Object {
-		panic("node type should be object")
-	}
-	m := make(map[string]*Node)
-	for i, kv := range n.ObjectValues {
-		m[kv.Key.AsString()] = n.ObjectValues[i].Value
+	m, err := n.TryAsMap()
+	if err != nil {
+		panic(err)
 	}
 	return m
 }
@@ -319,38 +556,25 @@ func (n *Node) AsJSON() string {
 
 // AsString as string
 func (n *Node) AsString() string {
-	switch n.Type {
-	case String:
-		s, err := stdUnmarshalString([]byte(n.Value))
-		if err != nil {
-			panic(fmt.Errorf("%v `%s`", err, n.Value))
-		}
-		return bytesToString(s)
-	case Bool:
-		if n.Value == trueVal {
-			return trueVal
-		}
-		return falseVal
-	case Integer, Float:
-		return n.Value
+	s, err := n.TryAsString()
+	if err != nil {
+		panic(err)
 	}
-	panic("node type should be simple value")
+	return s
 }
 
 // AsBool as boolean
 func (n *Node) AsBool() bool {
-	if n.Type != Bool {
-		panic("node type should be bool value")
+	b, err := n.TryAsBool()
+	if err != nil {
+		panic(err)
 	}
-	return n.Value == trueVal
+	return b
 }
 
 // AsInt as integer
 func (n *Node) AsInt() int64 {
-	if n.Type != Integer {
-		panic("node type should be integer value")
-	}
-	i, err := strconv.ParseInt(n.Value, 10, 64)
+	i, err := n.TryAsInt()
 	if err != nil {
 		panic(err)
 	}
@@ -359,10 +583,7 @@ func (n *Node) AsInt() int64 {
 
 // AsUint as unsigned integer
 func (n *Node) AsUint() uint64 {
-	if n.Type != Integer {
-		panic("node type should be unsigned integer value")
-	}
-	i, err := strconv.ParseUint(n.Value, 10, 64)
+	i, err := n.TryAsUint()
 	if err != nil {
 		panic(err)
 	}
@@ -371,19 +592,163 @@ func (n *Node) AsUint() uint64 {
 
 // AsFloat as float64
 func (n *Node) AsFloat() float64 {
-	if n.Type != Float {
-		panic("node type should be float value")
-	}
-	i, err := strconv.ParseFloat(n.Value, 64)
+	f, err := n.TryAsFloat()
 	if err != nil {
 		panic(err)
 	}
-	return i
+	return f
 }
 
 /* marshalers */
 
+/* containers nested deeper are written with an explicit stack, so that deep nesting won't grow goroutine stack */
+const maxMarshalRecursion = 64
+
 func nodeMarshalJSON(buf *bytes.Buffer, n *Node) {
+	if isContainer(n) {
+		recursiveMarshalJSON(buf, n, 0)
+	} else {
+		scalarMarshalJSON(buf, n)
+	}
+}
+
+/* recursiveMarshalJSON write node nested in depth plain containers, scalars are written without their raw text */
+func recursiveMarshalJSON(buf *bytes.Buffer, n *Node, depth int) {
+	switch n.Type {
+	case String, Integer:
+		buf.WriteString(n.Value)
+	case Float:
+		if isNonFinite(n.Value) {
+			buf.WriteString(nullVal)
+		} else {
+			buf.WriteString(n.Value)
+		}
+	case Null, Bool:
+		plainMarshalJSON(buf, n)
+	default:
+		if n.lazy != nil {
+			lazyMarshalJSON(buf, n.lazy)
+		} else if n.nodeTrivia() != nil {
+			losslessMarshalJSON(buf, n)
+		} else if depth >= maxMarshalRecursion {
+			stackMarshalJSON(buf, n)
+		} else if n.Type == Object {
+			buf.WriteByte(objectStart)
+			for i, elem := range n.ObjectValues {
+				if i > 0 {
+					buf.WriteByte(commaChar)
+				}
+				recursiveMarshalJSON(buf, elem.Key, depth)
+				buf.WriteByte(colonChar)
+				recursiveMarshalJSON(buf, elem.Value, depth+1)
+			}
+			buf.WriteByte(objectEnd)
+		} else {
+			buf.WriteByte(arrayStart)
+			for i, elem := range n.ArrayValues {
+				if i > 0 {
+					buf.WriteByte(commaChar)
+				}
+				recursiveMarshalJSON(buf, elem, depth+1)
+			}
+			buf.WriteByte(arrayEnd)
+		}
+	}
+}
+
+/* container being written by stackMarshalJSON and index of its next child */
+type marshalFrame struct {
+	node *Node
+	next int
+}
+
+/* stackMarshalJSON write node with an explicit stack, only ancestors of the container being written are on stack */
+func stackMarshalJSON(buf *bytes.Buffer, n *Node) {
+	var stackBuf [16]marshalFrame
+	stack := stackBuf[:0]
+	var cur *Node
+	var i int
+	for {
+		switch {
+		case n.Type != Object && n.Type != Array:
+			scalarMarshalJSON(buf, n)
+		case n.lazy != nil:
+			lazyMarshalJSON(buf, n.lazy)
+		case n.nodeTrivia() != nil:
+			losslessMarshalJSON(buf, n)
+		case n.Type == Object && len(n.ObjectValues) > 0, n.Type == Array && len(n.ArrayValues) > 0:
+			if cur != nil {
+				stack = append(stack, marshalFrame{node: cur, next: i})
+			}
+			if cur, i = n, 0; n.Type == Object {
+				buf.WriteByte(objectStart)
+			} else {
+				buf.WriteByte(arrayStart)
+			}
+		case n.Type == Object:
+			buf.WriteString(emptyObject)
+		default:
+			buf.WriteString(emptyArray)
+		}
+		/* write scalar children till the next child container, close finished containers */
+		for n = nil; n == nil; {
+			if cur == nil {
+				return
+			} else if cur.Type == Object {
+				values := cur.ObjectValues
+				for ; i < len(values) && n == nil; i++ {
+					if i > 0 {
+						buf.WriteByte(commaChar)
+					}
+					elem := values[i]
+					plainMarshalJSON(buf, elem.Key)
+					buf.WriteByte(colonChar)
+					if isContainer(elem.Value) {
+						n = elem.Value
+					} else {
+						plainMarshalJSON(buf, elem.Value)
+					}
+				}
+				if n == nil {
+					buf.WriteByte(objectEnd)
+				}
+			} else {
+				values := cur.ArrayValues
+				for ; i < len(values) && n == nil; i++ {
+					if i > 0 {
+						buf.WriteByte(commaChar)
+					}
+					if isContainer(values[i]) {
+						n = values[i]
+					} else {
+						plainMarshalJSON(buf, values[i])
+					}
+				}
+				if n == nil {
+					buf.WriteByte(arrayEnd)
+				}
+			}
+			if n == nil && len(stack) == 0 {
+				cur = nil
+			} else if n == nil {
+				cur, i = stack[len(stack)-1].node, stack[len(stack)-1].next
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+}
+
+/* scalarMarshalJSON write scalar, raw text of lossless scalar is kept if it's not modified */
+func scalarMarshalJSON(buf *bytes.Buffer, n *Node) {
+	if tr := n.nodeTrivia(); tr != nil && tr.raw != emptyVal && tr.value == n.Value {
+		buf.WriteString(tr.raw)
+		return
+	}
+	plainMarshalJSON(buf, n)
+}
+
+/* plainMarshalJSON write scalar child of plain container, raw text is only kept in lossless containers */
+func plainMarshalJSON(buf *bytes.Buffer, n *Node) {
 	switch n.Type {
 	case Null:
 		buf.WriteString(nullVal)
@@ -395,26 +760,15 @@ func nodeMarshalJSON(buf *bytes.Buffer, n *Node) {
 		} else {
 			buf.WriteString(falseVal)
 		}
-	case Integer, Float:
+	case Integer:
 		buf.WriteString(n.Value)
-	case Object:
-		buf.WriteByte(objectStart)
-		for i, elem := range n.ObjectValues {
-			objectElemMarshalJSON(buf, elem)
-			if i < len(n.ObjectValues)-1 {
-				buf.WriteByte(commaChar)
-			}
-		}
-		buf.WriteByte(objectEnd)
-	case Array:
-		buf.WriteByte(arrayStart)
-		for i, elem := range n.ArrayValues {
-			nodeMarshalJSON(buf, elem)
-			if i < len(n.ArrayValues)-1 {
-				buf.WriteByte(commaChar)
-			}
+	case Float:
+		/* infinity and NaN decoded from JSON5 are written as null like JSON.stringify does */
+		if isNonFinite(n.Value) {
+			buf.WriteString(nullVal)
+		} else {
+			buf.WriteString(n.Value)
 		}
-		buf.WriteByte(arrayEnd)
 	}
 }
 
@@ -444,69 +798,79 @@ func objectElemMarshalJSON(buf *bytes.Buffer, e *ObjectElem) {
 
 // Equal two nodes
 func (n *Node) Equal(o *Node) bool {
-	if (n == nil || n.IsNull()) && (o == nil || o.IsNull()) {
-		return true
-	} else if (n == nil || n.IsNull()) && (o != nil && !o.IsNull()) {
-		return false
-	} else if (n != nil && !n.IsNull()) && (o == nil || o.IsNull()) {
-		return false
-	}
-	if n.Type != o.Type {
-		return false
-	}
-	switch n.Type {
-	case String, Bool, Integer, Float:
-		return n.Value == o.Value
-	case Object:
-		objects1 := make(map[string]*Node)
-		objects2 := make(map[string]*Node)
-		for i, val := range n.ObjectValues {
-			if val == nil || val.Key == nil || val.Value == nil || val.Key.IsNull() || val.Value.IsNull() {
-				continue
-			}
-			objects1[val.Key.AsString()] = n.ObjectValues[i].Value
-		}
-		for i, val := range o.ObjectValues {
-			if val == nil || val.Key == nil || val.Value == nil || val.Key.IsNull() || val.Value.IsNull() {
-				continue
-			}
-			objects2[val.Key.AsString()] = o.ObjectValues[i].Value
+	/* compare node pairs with an explicit stack, so that deep nesting won't grow goroutine stack */
+	stack := [][2]*Node{{n, o}}
+	for len(stack) > 0 {
+		n, o := stack[len(stack)-1][0], stack[len(stack)-1][1]
+		stack = stack[:len(stack)-1]
+		if (n == nil || n.IsNull()) && (o == nil || o.IsNull()) {
+			continue
+		} else if (n == nil || n.IsNull()) && (o != nil && !o.IsNull()) {
+			return false
+		} else if (n != nil && !n.IsNull()) && (o == nil || o.IsNull()) {
+			return false
 		}
-		if len(objects1) != len(objects2) {
+		if n.Type != o.Type {
 			return false
 		}
-		for k, val := range objects1 {
-			if val2, ok := objects2[k]; !ok {
+		switch n.Type {
+		case String, Bool, Integer, Float:
+			if n.Value != o.Value {
 				return false
-			} else if !val.Equal(val2) {
+			}
+		case Object:
+			n.expand()
+			o.expand()
+			objects1 := make(map[string]*Node)
+			objects2 := make(map[string]*Node)
+			for i, val := range n.ObjectValues {
+				if val == nil || val.Key == nil || val.Value == nil || val.Key.IsNull() || val.Value.IsNull() {
+					continue
+				}
+				objects1[val.Key.AsString()] = n.ObjectValues[i].Value
+			}
+			for i, val := range o.ObjectValues {
+				if val == nil || val.Key == nil || val.Value == nil || val.Key.IsNull() || val.Value.IsNull() {
+					continue
+				}
+				objects2[val.Key.AsString()] = o.ObjectValues[i].Value
+			}
+			if len(objects1) != len(objects2) {
 				return false
 			}
-		}
-		return true
-	case Array:
-		slice1 := make([]*Node, 0, len(n.ArrayValues))
-		slice2 := make([]*Node, 0, len(o.ArrayValues))
-		for i, val := range n.ArrayValues {
-			if val == nil || val.IsNull() {
-				continue
+			for k, val := range objects1 {
+				val2, ok := objects2[k]
+				if !ok {
+					return false
+				}
+				stack = append(stack, [2]*Node{val, val2})
 			}
-			slice1 = append(slice1, n.ArrayValues[i])
-		}
-		for i, val := range o.ArrayValues {
-			if val == nil || val.IsNull() {
-				continue
+		case Array:
+			n.expand()
+			o.expand()
+			slice1 := make([]*Node, 0, len(n.ArrayValues))
+			slice2 := make([]*Node, 0, len(o.ArrayValues))
+			for i, val := range n.ArrayValues {
+				if val == nil || val.IsNull() {
+					continue
+				}
+				slice1 = append(slice1, n.ArrayValues[i])
 			}
-			slice2 = append(slice2, n.ArrayValues[i])
-		}
-		if len(slice1) != len(slice2) {
-			return false
-		}
-		for i, val := range slice1 {
-			if !val.Equal(slice2[i]) {
+			for i, val := range o.ArrayValues {
+				if val == nil || val.IsNull() {
+					continue
+				}
+				slice2 = append(slice2, o.ArrayValues[i])
+			}
+			if len(slice1) != len(slice2) {
 				return false
 			}
+			for i, val := range slice1 {
+				stack = append(stack, [2]*Node{val, slice2[i]})
+			}
+		default:
+			return false
 		}
-		return true
 	}
-	return false
+	return true
 }
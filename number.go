@@ -0,0 +1,137 @@
+package qjson
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+/* exponent beyond it is rejected by AsDecimal and AsBigInt, since the decimal text or integer would be huge */
+const maxDecimalExponent = 1 << 16
+
+/* numberTypeError is returned by number accessors for non-number node */
+func numberTypeError(n *Node) error {
+	return &TypeError{Expected: []NodeType{Integer, Float}, Actual: n.Type}
+}
+
+// AsBigInt as arbitrary-precision integer, float node with integral value is accepted too, e.g. 1.5e3
+func (n *Node) AsBigInt() (*big.Int, error) {
+	switch n.Type {
+	case Integer:
+		if i, ok := new(big.Int).SetString(n.Value, 10); ok {
+			return i, nil
+		}
+	case Float:
+		/* exact decimal text, float would round big exponents */
+		d, err := normalizeDecimal(n.Value)
+		if err != nil {
+			return nil, err
+		}
+		if i, ok := new(big.Int).SetString(d, 10); ok {
+			return i, nil
+		}
+	default:
+		return nil, numberTypeError(n)
+	}
+	return nil, fmt.Errorf("%s is not an integer", n.Value)
+}
+
+// AsBigFloat as arbitrary-precision float, precision is large enough to keep every digit of integers
+func (n *Node) AsBigFloat() (*big.Float, error) {
+	if n.Type != Integer && n.Type != Float {
+		return nil, numberTypeError(n)
+	}
+	prec := uint(len(n.Value)) * 4
+	if prec < 64 {
+		prec = 64
+	}
+	f, _, err := big.ParseFloat(n.Value, 10, prec, big.ToNearestEven)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a number: %v", n.Value, err)
+	}
+	return f, nil
+}
+
+// AsNumber as json.Number which keeps exact text of number
+func (n *Node) AsNumber() json.Number {
+	if n.Type != Integer && n.Type != Float {
+		panic(numberTypeError(n))
+	}
+	return json.Number(n.Value)
+}
+
+// AsDecimal as exact decimal text without exponent, leading zeros and trailing fraction zeros, e.g. 1.50e2 is 150
+func (n *Node) AsDecimal() (string, error) {
+	if n.Type != Integer && n.Type != Float {
+		return "", numberTypeError(n)
+	}
+	return normalizeDecimal(n.Value)
+}
+
+// SetBigInt set integer value and make node an integer node
+func (n *Node) SetBigInt(num *big.Int) *Node {
+	n.Type = Integer
+	n.Value = num.String()
+	return n
+}
+
+// SetNumber set number text and make node an integer or float node, it panics if num is not a json number
+func (n *Node) SetNumber(num json.Number) *Node {
+	value := string(num)
+	if value == "" {
+		panic("invalid json number ``")
+	} else if end, errOffset := scanStrictNumber(stringToBytes(value), 0); errOffset >= 0 || end != len(value) {
+		panic(fmt.Errorf("invalid json number `%s`", value))
+	}
+	fillNumberNode(n, []byte(value))
+	return n
+}
+
+func normalizeDecimal(value string) (string, error) {
+	s := value
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	var exp int
+	if idx := strings.IndexAny(s, "eE"); idx >= 0 {
+		e, err := strconv.Atoi(s[idx+1:])
+		if err != nil && !errors.Is(err, strconv.ErrRange) {
+			return "", fmt.Errorf("%s is not a decimal number", value)
+		} else if err != nil || e > maxDecimalExponent || e < -maxDecimalExponent {
+			return "", rangeError(value)
+		}
+		s, exp = s[:idx], e
+	}
+	intPart, fracPart := s, ""
+	if idx := strings.IndexByte(s, dotChar); idx >= 0 {
+		intPart, fracPart = s[:idx], s[idx+1:]
+	}
+	digits := intPart + fracPart
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return "", fmt.Errorf("%s is not a decimal number", value)
+	}
+	/* move decimal point by exponent, then pad zeros */
+	point := len(intPart) + exp
+	if point < 0 {
+		digits, point = strings.Repeat("0", -point)+digits, 0
+	} else if point > len(digits) {
+		digits += strings.Repeat("0", point-len(digits))
+	}
+	intPart = strings.TrimLeft(digits[:point], "0")
+	fracPart = strings.TrimRight(digits[point:], "0")
+	if intPart == "" {
+		intPart = "0"
+	}
+	var sb strings.Builder
+	if neg && (intPart != "0" || fracPart != "") {
+		sb.WriteByte(negativeChar)
+	}
+	sb.WriteString(intPart)
+	if fracPart != "" {
+		sb.WriteByte(dotChar)
+		sb.WriteString(fracPart)
+	}
+	return sb.String(), nil
+}
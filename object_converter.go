@@ -2,7 +2,9 @@ package qjson
 
 import (
 	"encoding/json"
+	"math"
 	"reflect"
+	"strconv"
 )
 
 const (
@@ -24,6 +26,24 @@ func (cvt converter) Convert(obj interface{}) (node *Node, err error) {
 	return cvt.ConvertAny(tp, v)
 }
 
+/* toNode convert value into node, nil is converted into null */
+func (cvt converter) toNode(value interface{}) (node *Node, err error) {
+	switch v := value.(type) {
+	case *Node:
+		node = v
+	case *JSONTree:
+		if v != nil {
+			node = v.Root
+		}
+	default:
+		node, err = cvt.Convert(value)
+	}
+	if node == nil && err == nil {
+		node = CreateNode()
+	}
+	return
+}
+
 func (cvt converter) stdConvertAny(inf interface{}) (node *Node, err error) {
 	if data, err := json.Marshal(inf); err != nil {
 		return nil, err
@@ -60,15 +80,26 @@ func (cvt converter) ConvertAny(tp reflect.Type, v reflect.Value) (node *Node, e
 		node = CreateIntegerNode().SetInt(v.Int())
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		node = CreateIntegerNode().SetUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, &json.UnsupportedValueError{Value: v, Str: strconv.FormatFloat(f, 'g', -1, 64)}
+		}
+		node = CreateNode()
+		fillNumberNode(node, formatFloat(f, tp.Bits()))
 	case reflect.String:
 		node = CreateStringNode().setStringBytes(stringToBytes(v.String()))
 	case reflect.Array, reflect.Slice:
 		node = CreateArrayNode()
 		for i := 0; i < v.Len(); i++ {
-			elemTp := tp.Elem()
-			if n, er := cvt.ConvertAny(elemTp, v.Index(i)); er == nil && n != nil {
-				node.ArrayValues = append(node.ArrayValues, n)
+			n, er := cvt.ConvertAny(tp.Elem(), v.Index(i))
+			if er != nil {
+				return nil, er
+			} else if n == nil {
+				/* nil pointer */
+				n = CreateNode()
 			}
+			node.ArrayValues = append(node.ArrayValues, n)
 		}
 	case reflect.Map:
 		if !v.IsNil() {
@@ -77,22 +108,47 @@ func (cvt converter) ConvertAny(tp reflect.Type, v reflect.Value) (node *Node, e
 			keyTp := tp.Key()
 			elemTp := tp.Elem()
 			for _, key := range keys {
-				if n, er := cvt.ConvertAny(elemTp, v.MapIndex(key)); er == nil && n != nil {
-					elem := CreateObjectElem()
-					if elem.Key, er = cvt.ConvertAny(keyTp, key); er != nil {
-						return nil, er
-					}
-					elem.Value = n
-					node.ObjectValues = append(node.ObjectValues, elem)
+				n, er := cvt.ConvertAny(elemTp, v.MapIndex(key))
+				if er != nil {
+					return nil, er
+				} else if n == nil {
+					n = CreateNode()
 				}
+				elem := CreateObjectElem()
+				if elem.Key, er = cvt.ConvertAny(keyTp, key); er != nil {
+					return nil, er
+				}
+				elem.Value = n
+				node.ObjectValues = append(node.ObjectValues, elem)
 			}
 		}
 	case reflect.Struct:
 		node, err = cvt.ConvertObject(tp, v)
+	case reflect.Complex64, reflect.Complex128, reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		return nil, &json.UnsupportedTypeError{Type: tp}
 	}
 	return
 }
 
+/* formatFloat format float like encoding/json, so integral floats are decoded back as integers, e.g. 3.0 is 3 */
+func formatFloat(f float64, bits int) []byte {
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bits == 64 && (abs < 1e-6 || abs >= 1e21) || bits == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	b := strconv.AppendFloat(nil, f, format, -1, bits)
+	if format == 'e' {
+		/* clean up e-09 to e-9 */
+		if n := len(b); n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
+
 func (cvt converter) ConvertObject(tp reflect.Type, v reflect.Value) (node *Node, err error) {
 	node = CreateObjectNode()
 	for i := 0; i < tp.NumField(); i++ {
@@ -0,0 +1,106 @@
+package qjson
+
+import (
+	"runtime"
+	"sync"
+)
+
+/* input is not split into chunks smaller than it, goroutines cost more than decoding them */
+const minParallelChunk = 32 << 10
+
+// DecodeParallel decode raw json bytes like Decode, but elements of top level array are decoded by workers concurrently,
+// workers <= 0 means runtime.GOMAXPROCS(0). Input other than a big array is decoded by Decode.
+func DecodeParallel(jsonBytes []byte, workers int) (*JSONTree, error) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if max := len(jsonBytes) / minParallelChunk; workers > max {
+		workers = max
+	}
+	bounds, ok := splitArray(jsonBytes, workers)
+	if !ok || len(bounds) < 3 {
+		return Decode(jsonBytes)
+	}
+	chunks := make([][]*Node, len(bounds)-1)
+	errs := make([]error, len(bounds)-1)
+	var wg sync.WaitGroup
+	for i := range chunks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			d := decodePool.Get().(*decodeState)
+			defer d.release()
+			chunks[i], errs[i] = d.decodeChunk(jsonBytes, bounds[i]+1, bounds[i+1], i == len(chunks)-1)
+		}(i)
+	}
+	wg.Wait()
+	var count int
+	for i, err := range errs {
+		if err != nil {
+			/* chunks may be split wrongly in bad input, decode again to get the same error as Decode */
+			return Decode(jsonBytes)
+		}
+		count += len(chunks[i])
+	}
+	tree := makeNewTree()
+	tree.Root.Type = Array
+	tree.Root.ArrayValues = make([]*Node, 0, count)
+	for _, chunk := range chunks {
+		tree.Root.ArrayValues = append(tree.Root.ArrayValues, chunk...)
+	}
+	return tree, nil
+}
+
+/* decode elements of top level array in data[start:end], the last chunk ends with the closing bracket */
+func (d *decodeState) decodeChunk(data []byte, start, end int, last bool) ([]*Node, error) {
+	node := CreateNode()
+	node.Type = Array
+	s := &d.init(data[:end], DecodeOptions{}).scanner
+	s.partial = !last
+	s.offset = start
+	s.stack = append(s.stack, scanFrame{kind: arrayStart, offset: start - 1})
+	d.stack = append(d.stack, node)
+	if err := d.decode(node); err != nil {
+		return nil, err
+	}
+	return node.ArrayValues, nil
+}
+
+/* splitArray pre-scan top level array into at most n chunks of similar size, ok is false if input is not an array */
+func splitArray(data []byte, n int) (bounds []int, ok bool) {
+	/* bounds are offsets of [, commas between chunks, and the offset after ] */
+	start := searchFirstValidChar(data, 0)
+	if n < 2 || start < 0 || data[start] != arrayStart {
+		return nil, false
+	}
+	step := (len(data) - start) / n
+	next := start + step
+	bounds = append(make([]int, 0, n+1), start)
+	var depth int
+	for i := start; i < len(data); i++ {
+		switch data[i] {
+		case quote:
+			end := scanString(data, i)
+			if end < 0 {
+				return nil, false
+			}
+			i = end - 1
+		case objectStart, arrayStart:
+			depth++
+		case objectEnd, arrayEnd:
+			if depth--; depth > 0 {
+				continue
+			}
+			if data[i] != arrayEnd || searchFirstValidChar(data, i+1) >= 0 {
+				return nil, false
+			}
+			return append(bounds, i+1), true
+		case commaChar:
+			if depth == 1 && i >= next && len(bounds) < n {
+				bounds = append(bounds, i)
+				next = i + step
+			}
+		}
+	}
+	return nil, false
+}
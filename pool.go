@@ -39,6 +39,8 @@ func CreateNode() *Node {
 	node.Value = emptyVal
 	node.Type = Null
 	node.hashId = 0
+	node.lazy = nil
+	node.ext = nil
 	return node
 }
 
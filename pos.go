@@ -0,0 +1,78 @@
+package qjson
+
+import (
+	"strconv"
+	"unicode/utf8"
+)
+
+const maxPosChunk = 1024
+
+// Pos describe where a node is in decode input
+type Pos struct {
+	// Offset is the byte offset of the first byte of node, End is the offset after the last byte
+	Offset int
+	End    int
+	// Line and Column of the first byte, they are 1-based, Column counts runes
+	Line   int
+	Column int
+}
+
+// IsValid tell position is recorded or not
+func (p Pos) IsValid() bool {
+	return p.Line > 0
+}
+
+// String returns line:column
+func (p Pos) String() string {
+	return strconv.Itoa(p.Line) + ":" + strconv.Itoa(p.Column)
+}
+
+// Pos returns source position of node, it's only recorded when decoded with DecodeOptions.Positions
+func (n *Node) Pos() Pos {
+	if pos := n.nodePos(); pos != nil {
+		return *pos
+	}
+	return Pos{}
+}
+
+/* posTracker turns token offsets into positions, offsets only move forward so lines are counted once */
+type posTracker struct {
+	base   Pos
+	offset int
+	line   int
+	column int
+	buf    []Pos
+	exts   extChunk
+}
+
+/* reset tracker to start at base, which is the position of input start */
+func (t *posTracker) reset(base Pos) {
+	t.base, t.offset, t.line, t.column = base, 0, base.Line, base.Column
+}
+
+/* record position of node which starts at tok */
+func (t *posTracker) record(data []byte, node *Node, tok Token) {
+	for _, b := range data[t.offset:tok.Offset] {
+		if b == '\n' {
+			t.line++
+			t.column = 1
+		} else if utf8.RuneStart(b) {
+			t.column++
+		}
+	}
+	t.offset = tok.Offset
+	/* positions are allocated in chunks, nodes point into them */
+	if len(t.buf) == cap(t.buf) {
+		t.buf = make([]Pos, 0, min(maxPosChunk, 2*cap(t.buf)+8))
+	}
+	start := t.base.Offset + tok.Offset
+	t.buf = append(t.buf, Pos{Offset: start, End: start + len(tok.Raw), Line: t.line, Column: t.column})
+	t.exts.alloc(node).pos = &t.buf[len(t.buf)-1]
+}
+
+/* set end of container node, end is the offset after its last byte */
+func (t *posTracker) end(node *Node, end int) {
+	if pos := node.nodePos(); pos != nil {
+		pos.End = t.base.Offset + end
+	}
+}
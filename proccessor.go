@@ -2,8 +2,7 @@ package qjson
 
 import (
 	"bytes"
-	"errors"
-	"fmt"
+	"io"
 	"strings"
 	"sync"
 )
@@ -43,164 +42,217 @@ const (
 	trueValLen  = len(trueVal)
 	falseValLen = len(falseVal)
 	emptyVal    = ""
+	emptyObject = "{}"
+	emptyArray  = "[]"
 )
 
-/* decode json entry function */
-func decodeAny(jsonBytes []byte, offset int, tree *JSONTree) (int, error) {
-	if offset >= len(jsonBytes) {
-		return 0, errors.New("bad json")
-	}
+/* decodeState build node tree from tokens of scanner */
+type decodeState struct {
+	scanner  Scanner
+	stack    []*Node
+	key      *Node
+	dupIndex int
+	lazyOpts *DecodeOptions
+	pos      posTracker
+	trivia   triviaTracker
+	stackBuf [16]*Node
+}
 
-	var err error
-	if nextValueIsObject(jsonBytes, offset) {
-		offset, err = fillObjectNode(jsonBytes, offset, tree.Root)
-	} else if nextValueIsArray(jsonBytes, offset) {
-		offset, err = fillArrayNode(jsonBytes, offset, tree.Root)
-	} else if nextValueIsNull(jsonBytes, offset) {
-		offset = fillNullNode(jsonBytes, offset, tree.Root)
-	} else if nextValueIsBool(jsonBytes, offset) {
-		offset = fillBoolNode(jsonBytes, offset, tree.Root)
-	} else if nextValueIsNumber(jsonBytes, offset) {
-		offset = fillNumberNode(jsonBytes, offset, tree.Root)
-	} else if nextValueIsString(jsonBytes, offset) {
-		offset = fillStringNode(jsonBytes, offset, tree.Root)
-	} else {
-		err = fmt.Errorf("unknown json char %s", jsonBytes[offset:])
-	}
-	if err == nil {
-		if searchFirstValidChar(jsonBytes, offset) >= 0 {
-			err = fmt.Errorf("should nothing any more after %s", jsonBytes[:offset])
-		}
-	}
-	return offset, err
+func (d *decodeState) init(jsonBytes []byte, opts DecodeOptions) *decodeState {
+	d.scanner.init(jsonBytes, opts)
+	d.stack = d.stackBuf[:0]
+	d.dupIndex = -1
+	d.pos.reset(Pos{Line: 1, Column: 1})
+	d.trivia.reset(true)
+	return d
 }
 
-/* node populate functions */
+/* drop references to input and nodes before putting back to pool */
+func (d *decodeState) release() {
+	d.scanner.init(nil, DecodeOptions{})
+	d.stackBuf = [len(d.stackBuf)]*Node{}
+	d.stack, d.key, d.lazyOpts = nil, nil, nil
+	d.pos.buf, d.pos.exts = nil, nil
+	d.trivia.prev, d.trivia.buf, d.trivia.exts = nil, nil, nil
+	decodePool.Put(d)
+}
 
-func fillObjectNode(jsonBytes []byte, offset int, node *Node) (int, error) {
-	node.Type = Object
-	offset++
+/* decode json entry function */
+func (d *decodeState) decode(root *Node) error {
+	if d.scanner.err != nil {
+		return d.scanner.err
+	}
+	positions, lossless := d.scanner.opts.Positions, d.scanner.opts.Lossless
 	for {
-		if nextOffset := searchFirstValidChar(jsonBytes, offset); nextOffset == -1 {
-			return 0, fmt.Errorf("unexpected json char %s", jsonBytes[offset:])
-		} else if jsonBytes[nextOffset] == objectEnd {
-			offset = nextOffset
-			break
-		} else if jsonBytes[nextOffset] == commaChar {
-			offset = nextOffset + 1
-			continue
-		} else {
-			offset = nextOffset
-		}
-		var err error
-
-		elem := CreateObjectElem()
-		elem.Key = CreateNode()
-		elem.Value = CreateNode()
-
-		if nextValueIsBool(jsonBytes, offset) {
-			offset = fillBoolNode(jsonBytes, offset, elem.Key)
-		} else if nextValueIsNumber(jsonBytes, offset) {
-			offset = fillNumberNode(jsonBytes, offset, elem.Key)
-		} else if nextValueIsString(jsonBytes, offset) {
-			offset = fillStringNode(jsonBytes, offset, elem.Key)
-		} else {
-			return 0, fmt.Errorf("unexpected json char %s", jsonBytes[offset:])
-		}
-		/* should find : */
-		if nextOffset := nextValueShouldBe(jsonBytes, offset, colonChar); nextOffset == -1 {
-			return 0, fmt.Errorf("expect :, unexpected json char %s", jsonBytes[offset:])
-		} else if offset = searchFirstValidChar(jsonBytes, nextOffset+1); offset == -1 {
-			return 0, fmt.Errorf("expect object value, unexpected json char %s", jsonBytes[nextOffset+1:])
+		/* scanner is dropped after the first error, so no need to keep error sticky */
+		tok, err := d.scanner.next()
+		if err == io.EOF {
+			if lossless {
+				d.finishTrivia(root)
+			}
+			return nil
+		} else if err != nil {
+			return err
 		}
-
-		if nextValueIsObject(jsonBytes, offset) {
-			if offset, err = fillObjectNode(jsonBytes, offset, elem.Value); err != nil {
-				return 0, err
+		/* value of duplicate key is dropped */
+		if d.dupIndex >= 0 && d.scanner.opts.DuplicateKeys == DuplicateKeysKeepFirst {
+			d.dupIndex, d.key = -1, nil
+			if err = d.skipValue(tok); err != nil {
+				return err
 			}
-		} else if nextValueIsArray(jsonBytes, offset) {
-			if offset, err = fillArrayNode(jsonBytes, offset, elem.Value); err != nil {
-				return 0, err
+			if lossless {
+				d.trivia.skipped(nil, d.scanner.offset)
 			}
-		} else if nextValueIsNull(jsonBytes, offset) {
-			offset = fillNullNode(jsonBytes, offset, elem.Value)
-		} else if nextValueIsBool(jsonBytes, offset) {
-			offset = fillBoolNode(jsonBytes, offset, elem.Value)
-		} else if nextValueIsNumber(jsonBytes, offset) {
-			offset = fillNumberNode(jsonBytes, offset, elem.Value)
-		} else if nextValueIsString(jsonBytes, offset) {
-			offset = fillStringNode(jsonBytes, offset, elem.Value)
-		} else {
-			return 0, fmt.Errorf("unknown json char %s", jsonBytes[offset:])
-		}
-		node.ObjectValues = append(node.ObjectValues, elem)
-	}
-	return offset + 1, nil
-}
-
-func fillArrayNode(jsonBytes []byte, offset int, node *Node) (int, error) {
-	node.Type = Array
-	offset++
-	for {
-		if nextOffset := searchFirstValidChar(jsonBytes, offset); nextOffset == -1 {
-			return 0, fmt.Errorf("unexpected json char %s", jsonBytes[offset:])
-		} else if jsonBytes[nextOffset] == arrayEnd {
-			offset = nextOffset
-			break
-		} else if jsonBytes[nextOffset] == commaChar {
-			offset = nextOffset + 1
 			continue
-		} else {
-			offset = nextOffset
 		}
-		var err error
-		elem := CreateNode()
-		if nextValueIsBool(jsonBytes, offset) {
-			offset = fillBoolNode(jsonBytes, offset, elem)
-		} else if nextValueIsNumber(jsonBytes, offset) {
-			offset = fillNumberNode(jsonBytes, offset, elem)
-		} else if nextValueIsString(jsonBytes, offset) {
-			offset = fillStringNode(jsonBytes, offset, elem)
-		} else if nextValueIsNull(jsonBytes, offset) {
-			offset = fillNullNode(jsonBytes, offset, elem)
-		} else if nextValueIsArray(jsonBytes, offset) {
-			if offset, err = fillArrayNode(jsonBytes, offset, elem); err != nil {
-				return 0, err
+		key := d.key
+		switch tok.Kind {
+		case TokenBeginObject, TokenBeginArray:
+			node := d.nextNode(root)
+			node.Type = Object
+			if tok.Kind == TokenBeginArray {
+				node.Type = Array
+			}
+			if positions {
+				d.pos.record(d.scanner.data, node, tok)
+			}
+			if lossless {
+				d.recordTrivia(node, key, tok)
+			}
+			/* lazy mode only decode the outermost container */
+			if d.scanner.opts.Lazy && len(d.stack) > 0 {
+				if err = d.skipLazyNode(node, tok); err != nil {
+					return err
+				}
+				if lossless {
+					d.trivia.skipped(node, d.scanner.offset)
+				}
+				continue
+			}
+			d.stack = append(d.stack, node)
+		case TokenEndObject, TokenEndArray:
+			if positions {
+				d.pos.end(d.stack[len(d.stack)-1], tok.Offset+1)
+			}
+			if lossless {
+				d.recordTrivia(d.stack[len(d.stack)-1], nil, tok)
+			}
+			d.stack = d.stack[:len(d.stack)-1]
+		case TokenKey:
+			d.key = CreateNode()
+			d.dupIndex = d.scanner.dupIndex
+			fillScalarNode(d.key, tok)
+			if positions {
+				d.pos.record(d.scanner.data, d.key, tok)
+			}
+			if lossless {
+				d.recordTrivia(d.key, nil, tok)
+			}
+		default:
+			node := d.nextNode(root)
+			fillScalarNode(node, tok)
+			if positions {
+				d.pos.record(d.scanner.data, node, tok)
 			}
-		} else if nextValueIsObject(jsonBytes, offset) {
-			if offset, err = fillObjectNode(jsonBytes, offset, elem); err != nil {
-				return 0, err
+			if lossless {
+				d.recordTrivia(node, key, tok)
 			}
-		} else {
-			return 0, fmt.Errorf("unexpected json char %s", jsonBytes[offset:])
 		}
-
-		node.ArrayValues = append(node.ArrayValues, elem)
 	}
-	return offset + 1, nil
+}
 
+/* create node for next value in current container */
+func (d *decodeState) nextNode(root *Node) *Node {
+	if len(d.stack) == 0 {
+		return root
+	}
+	parent := d.stack[len(d.stack)-1]
+	if parent.Type == Object && d.dupIndex >= 0 {
+		/* value of duplicate key replaces the kept one */
+		elem := parent.ObjectValues[d.dupIndex]
+		elem.Value = CreateNode()
+		d.dupIndex, d.key = -1, nil
+		return elem.Value
+	} else if parent.Type == Object {
+		elem := CreateObjectElem()
+		elem.Key = d.key
+		elem.Value = CreateNode()
+		d.key = nil
+		parent.ObjectValues = append(parent.ObjectValues, elem)
+		return elem.Value
+	}
+	node := CreateNode()
+	parent.ArrayValues = append(parent.ArrayValues, node)
+	return node
 }
 
-func fillNullNode(jsonBytes []byte, offset int, node *Node) int {
-	node.Type = Null
-	node.Value = nullVal
-	return offset + nullLen
+/* node populate functions */
+
+func fillScalarNode(node *Node, tok Token) {
+	if tok.json5 {
+		fillJSON5Node(node, tok)
+		return
+	} else if tok.invalidUTF8 {
+		node.Type = String
+		node.Value = replaceInvalidUTF8(tok.Raw)
+		return
+	}
+	switch tok.Kind {
+	case TokenString:
+		fillStringNode(node, tok.Raw)
+	case TokenNumber:
+		fillNumberNode(node, tok.Raw)
+	case TokenBool:
+		fillBoolNode(node, tok.Raw)
+	case TokenNull:
+		node.Type = Null
+		node.Value = nullVal
+	case TokenKey:
+		/* key may be number or bool in lenient mode */
+		switch tok.Raw[0] {
+		case quote:
+			fillStringNode(node, tok.Raw)
+		case 't', 'f':
+			fillBoolNode(node, tok.Raw)
+		default:
+			fillNumberNode(node, tok.Raw)
+		}
+	}
 }
 
-func fillBoolNode(jsonBytes []byte, offset int, node *Node) int {
+func fillBoolNode(node *Node, raw []byte) {
 	node.Type = Bool
-	if bytesToString(jsonBytes[offset:offset+trueValLen]) == trueVal {
+	if raw[0] == 't' {
 		node.Value = trueVal
-		offset += trueValLen
 	} else {
 		node.Value = falseVal
-		offset += falseValLen
 	}
-	return offset
 }
 
-func fillNumberNode(jsonBytes []byte, offset int, node *Node) int {
-	start := offset
+func fillNumberNode(node *Node, raw []byte) {
+	node.Value = bytesToString(raw)
+	if strings.Contains(node.Value, dotString) || strings.Index(node.Value, "e") > 0 || strings.Index(node.Value, "E") > 0 {
+		node.Type = Float
+	} else {
+		node.Type = Integer
+	}
+}
+
+func fillStringNode(node *Node, raw []byte) {
+	node.Type = String
+	node.Value = bytesToString(raw)
+}
+
+/* scan functions return end offset of the token starting at offset */
+
+func scanBool(jsonBytes []byte, offset int) int {
+	if jsonBytes[offset] == 't' {
+		return offset + trueValLen
+	}
+	return offset + falseValLen
+}
+
+func scanNumber(jsonBytes []byte, offset int) int {
 	for ; offset < len(jsonBytes); offset++ {
 		b := jsonBytes[offset]
 		if b == dotChar || b == negativeChar ||
@@ -210,35 +262,19 @@ func fillNumberNode(jsonBytes []byte, offset int, node *Node) int {
 		}
 		break
 	}
-
-	node.Value = bytesToString(jsonBytes[start:offset])
-	if strings.Contains(node.Value, dotString) || strings.Index(node.Value, "e") > 0 || strings.Index(node.Value, "E") > 0 {
-		node.Type = Float
-	} else {
-		node.Type = Integer
-	}
 	return offset
 }
 
-func fillStringNode(jsonBytes []byte, offset int, node *Node) int {
-	start := offset
-	var skipNextChar bool
+/* return -1 if string is not closed */
+func scanString(jsonBytes []byte, offset int) int {
 	for offset = offset + 1; offset < len(jsonBytes); offset++ {
-		if skipNextChar {
-			skipNextChar = false
-			continue
-		}
-		b := jsonBytes[offset]
-		if b == escapeChar {
-			skipNextChar = true
-		} else if b == quote {
+		if b := jsonBytes[offset]; b == escapeChar {
 			offset++
-			break
+		} else if b == quote {
+			return offset + 1
 		}
 	}
-	node.Type = String
-	node.Value = bytesToString(jsonBytes[start:offset])
-	return offset
+	return -1
 }
 
 /* search first valid char from offset, return found index or -1 */
@@ -253,6 +289,14 @@ func searchFirstValidChar(jsonBytes []byte, offset int) int {
 	return -1
 }
 
+/* search first valid char from offset, return found index or len(jsonBytes) */
+func searchValidCharOrEnd(jsonBytes []byte, offset int) int {
+	if idx := searchFirstValidChar(jsonBytes, offset); idx >= 0 {
+		return idx
+	}
+	return len(jsonBytes)
+}
+
 /* next char detect fuctions */
 
 func nextValueIsNumber(jsonBytes []byte, offset int) bool {
@@ -279,7 +323,7 @@ func nextValueIsNumber(jsonBytes []byte, offset int) bool {
 			break
 		}
 	}
-	word := string(jsonBytes[start:offset])
+	word := bytesToString(jsonBytes[start:offset])
 	if strings.Count(word, dotString) > 1 {
 		return false
 	}
@@ -292,23 +336,6 @@ func nextValueIsNumber(jsonBytes []byte, offset int) bool {
 	return true
 }
 
-func nextValueIsString(jsonBytes []byte, offset int) bool {
-	if jsonBytes[offset] != quote {
-		return false
-	}
-	for offset = offset + 1; offset < len(jsonBytes); {
-		b := jsonBytes[offset]
-		if b == escapeChar {
-			offset += 2
-			continue
-		} else if b == quote {
-			return true
-		}
-		offset++
-	}
-	return false
-}
-
 func nextValueIsObject(jsonBytes []byte, offset int) bool {
 	return jsonBytes[offset] == objectStart
 }
@@ -344,4 +371,7 @@ func nextValueShouldBe(jsonBytes []byte, offset int, options ...byte) int {
 }
 
 /* active object pools */
-var bytesPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+var (
+	bytesPool  = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+	decodePool = sync.Pool{New: func() interface{} { return new(decodeState) }}
+)
@@ -13,14 +13,70 @@ func New() *JSONTree {
 	return makeNewTree()
 }
 
+// DecodeOptions control how raw json bytes are decoded
+type DecodeOptions struct {
+	// Strict rejects any input not conforming to RFC 8259: non-string keys, missing or extra commas,
+	// malformed numbers and literals, bad escapes, raw control chars, invalid UTF-8 and empty input
+	Strict bool
+	// Lazy only decodes the outermost container, children containers keep their raw bytes
+	// and are decoded on demand, see Node.Expand. Reading a lazy tree may modify it,
+	// so it must not be read concurrently.
+	Lazy bool
+	// JSON5 accepts JSON5/JSONC syntax: comments, trailing commas, single-quoted and multi-line strings,
+	// identifier keys, hex numbers, leading or trailing decimal point, +/-Infinity and NaN.
+	// They are normalized to standard json nodes, but Infinity and NaN are kept as Float nodes in JSON5 syntax,
+	// so AsFloat returns them. Json can't express them, so they are marshaled as null like JSON.stringify does,
+	// unless Lossless keeps their raw text.
+	// With Strict, commas are still required and keys must be strings or identifiers.
+	JSON5 bool
+	// Copy copies input before decoding, by default nodes alias input bytes, so input must not be modified
+	// while the tree is in use. See JSONTree.Detach too.
+	Copy bool
+	// Positions records source position of every node, see Node.Pos
+	Positions bool
+	// Lossless keeps whitespace, comments and raw text of tokens, so JSONTree.MarshalJSON re-emits
+	// untouched parts byte-for-byte and only edited values change. New elements copy layout of their siblings.
+	// Note encoding/json compacts output of MarshalJSON, so json.Marshal and JSONString drop the layout.
+	Lossless bool
+	// DetectEncoding drops UTF-8 BOM, and transcodes UTF-16 or UTF-32 input into UTF-8 as RFC 8259 section 8.1 suggests,
+	// encoding is detected by BOM or null bytes. Offsets in positions and errors refer to the transcoded input.
+	DetectEncoding bool
+	// InvalidUTF8 decide how to decode strings having invalid UTF-8, Strict mode always rejects them
+	InvalidUTF8 InvalidUTF8
+	// DuplicateKeys decide how to decode duplicate keys of object, default is DuplicateKeysKeepAll
+	DuplicateKeys DuplicateKeys
+	// MaxDepth limits nesting level of containers, the outermost container is at level 1
+	MaxDepth int
+	// MaxInputBytes limits size of input, for Decoder it limits size of every value
+	MaxInputBytes int
+	// MaxArrayLen limits element count of every array
+	MaxArrayLen int
+	// MaxObjectKeys limits key count of every object
+	MaxObjectKeys int
+	// MaxStringLen limits raw bytes count between quotes of every string, including keys
+	MaxStringLen int
+}
+
 // Decode raw json bytes into JSONTree
 func Decode(jsonBytes []byte) (*JSONTree, error) {
-	tree := makeNewTree()
-	offset := searchFirstValidChar(jsonBytes, 0)
-	if offset == -1 {
-		return tree, nil
+	return DecodeWithOptions(jsonBytes, DecodeOptions{})
+}
+
+// DecodeWithOptions decode raw json bytes into JSONTree with options
+func DecodeWithOptions(jsonBytes []byte, opts DecodeOptions) (*JSONTree, error) {
+	return decodeTree(jsonBytes, opts, Pos{Line: 1, Column: 1})
+}
+
+/* decode input which starts at base position */
+func decodeTree(jsonBytes []byte, opts DecodeOptions, base Pos) (*JSONTree, error) {
+	if opts.Copy {
+		jsonBytes = copyBytes(jsonBytes)
 	}
-	if _, err := decodeAny(jsonBytes, offset, tree); err != nil {
+	tree := makeNewTree()
+	d := decodePool.Get().(*decodeState)
+	defer d.release()
+	d.init(jsonBytes, opts).pos.reset(base)
+	if err := d.decode(tree.Root); err != nil {
 		return nil, err
 	}
 	return tree, nil
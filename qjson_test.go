@@ -2,12 +2,21 @@ package qjson
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
+	"math/big"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	"encoding/json"
 
@@ -1464,3 +1473,1344 @@ func (suite *JSONTreeTestSuite) TestDiff() {
 		DiffItem{DiffOfValue, "a", `"undefined"`, undefined},
 	)
 }
+
+func (suite *JSONTreeTestSuite) TestSyntaxError() {
+	_, err := Decode([]byte("{\n  \"a\": 1,\n  \"b\" 2\n}"))
+	serr, ok := err.(*SyntaxError)
+	suite.True(ok)
+	suite.Equal(18, serr.Offset)
+	suite.Equal(3, serr.Line)
+	suite.Equal(7, serr.Column)
+	suite.Equal(expectColon, serr.Expect)
+	suite.Equal("  \"b\" 2\n      ^", serr.Excerpt)
+	suite.Equal(`unexpected char '2' at line 3, column 7 (offset 18), expect ':'`, serr.Error())
+
+	_, err = Decode([]byte(`[1,2`))
+	serr, ok = err.(*SyntaxError)
+	suite.True(ok)
+	suite.Equal(4, serr.Offset)
+	suite.Equal("unexpected end of input", serr.Msg)
+
+	_, err = Decode([]byte(`{"a":1} x`))
+	serr, ok = err.(*SyntaxError)
+	suite.True(ok)
+	suite.Equal(8, serr.Offset)
+	suite.Equal(expectEnd, serr.Expect)
+
+	long := `{"key":"` + strings.Repeat("x", 100) + `"}` + strings.Repeat(" ", 100) + `x`
+	_, err = Decode([]byte(`[` + long))
+	serr, ok = err.(*SyntaxError)
+	suite.True(ok)
+	suite.Equal(len(long), serr.Offset)
+	suite.Equal(`...`+strings.Repeat(" ", 20)+"x\n"+strings.Repeat(" ", 23)+"^", serr.Excerpt)
+}
+
+func (suite *JSONTreeTestSuite) TestDecodeStrict() {
+	strict := DecodeOptions{Strict: true}
+	for _, s := range []string{text1, text2, text3, `1`, `-0.5e+10`, `"é\n\/"`, `[]`, `{}`, ` [1, {"a": [true, false, null]}] `} {
+		_, err := DecodeWithOptions([]byte(s), strict)
+		suite.NoError(err, s)
+	}
+	invalid := []string{
+		``,
+		`1-2`,
+		`01`,
+		`1.`,
+		`.5`,
+		`-`,
+		`1e`,
+		`truex`,
+		`[truefalse]`,
+		`{1:2}`,
+		`{true:2}`,
+		`[1,,2]`,
+		`[,1]`,
+		`[1,]`,
+		`[1 2]`,
+		`{,}`,
+		`{"a":1,}`,
+		`{"a":1 "b":2}`,
+		`"\x"`,
+		`"\u12g4"`,
+		"\"a\tb\"",
+		"\"\xff\"",
+		`"abc`,
+	}
+	for _, s := range invalid {
+		_, err := DecodeWithOptions([]byte(s), strict)
+		suite.IsType(&SyntaxError{}, err, s)
+		/* default mode stays lenient */
+		if s == `1-2` || s == `[1,,2]` || s == `{,}` || s == `{1:2}` {
+			_, err = Decode([]byte(s))
+			suite.NoError(err, s)
+		}
+	}
+
+	_, err := DecodeWithOptions([]byte(`[1,]`), strict)
+	suite.Equal(expectValueOnly, err.(*SyntaxError).Expect)
+	_, err = DecodeWithOptions([]byte(`{"a":1 "b":2}`), strict)
+	suite.Equal(expectCommaObjectEnd, err.(*SyntaxError).Expect)
+	suite.Equal(7, err.(*SyntaxError).Offset)
+}
+
+func (suite *JSONTreeTestSuite) TestStreamDecoder() {
+	stream := "{\"a\":1}\n[1,\"]\",{\"b\":[]}]\n\n\"str\" 12 -1.5e3 true null{}\t[]\n"
+	expects := []string{`{"a":1}`, `[1,"]",{"b":[]}]`, `"str"`, `12`, `-1.5e3`, `true`, `null`, `{}`, `[]`}
+	for _, r := range []io.Reader{strings.NewReader(stream), iotest.OneByteReader(strings.NewReader(stream))} {
+		dec := NewDecoder(r)
+		var got []string
+		for dec.More() {
+			tree, err := dec.Decode()
+			suite.NoError(err)
+			got = append(got, tree.JSONString())
+		}
+		suite.Equal(expects, got)
+		_, err := dec.Decode()
+		suite.Equal(io.EOF, err)
+	}
+
+	/* buffer is bounded by the largest value rather than the whole stream */
+	line := `{"key":"` + strings.Repeat("x", 100) + `"}` + "\n"
+	dec := NewDecoder(strings.NewReader(strings.Repeat(line, 1000)))
+	var cnt int
+	for dec.More() {
+		tree, err := dec.Decode()
+		suite.NoError(err)
+		suite.Equal(strings.Repeat("x", 100), tree.Find("key").AsString())
+		cnt++
+	}
+	suite.Equal(1000, cnt)
+	suite.True(cap(dec.buf) < 4*minReadSize)
+
+	dec = NewDecoder(strings.NewReader("1\n{\"a\":1}\n{\"a\" 1}\n2"))
+	_, err := dec.Decode()
+	suite.NoError(err)
+	_, err = dec.Decode()
+	suite.NoError(err)
+	_, err = dec.Decode()
+	serr, ok := err.(*SyntaxError)
+	suite.True(ok)
+	suite.Equal(15, serr.Offset)
+	suite.Equal(3, serr.Line)
+	suite.Equal(6, serr.Column)
+	suite.False(dec.More())
+	_, err = dec.Decode()
+	suite.Equal(serr, err)
+
+	_, err = NewDecoder(strings.NewReader(`[1,2`)).Decode()
+	suite.IsType(&SyntaxError{}, err)
+}
+
+func (suite *JSONTreeTestSuite) TestScanner() {
+	data := []byte(`{"a": [1, -2.5, "x"], "b": {"c": true, "d": null}, "e": []}`)
+	scanner := NewScanner(data)
+	var tokens []string
+	var sum float64
+	for {
+		tok, err := scanner.Next()
+		if err == io.EOF {
+			break
+		}
+		suite.NoError(err)
+		suite.Equal(string(data[tok.Offset:tok.Offset+len(tok.Raw)]), string(tok.Raw))
+		tokens = append(tokens, tok.Kind.String()+":"+string(tok.Raw))
+		if tok.Kind == TokenNumber {
+			f, _ := strconv.ParseFloat(string(tok.Raw), 64)
+			sum += f
+		}
+	}
+	suite.Equal([]string{
+		"BeginObject:{", `Key:"a"`, "BeginArray:[", "Number:1", "Number:-2.5", `String:"x"`, "EndArray:]",
+		`Key:"b"`, "BeginObject:{", `Key:"c"`, "Bool:true", `Key:"d"`, "Null:null", "EndObject:}",
+		`Key:"e"`, "BeginArray:[", "EndArray:]", "EndObject:}",
+	}, tokens)
+	suite.Equal(-1.5, sum)
+	suite.Equal(0, scanner.Depth())
+	_, err := scanner.Next()
+	suite.Equal(io.EOF, err)
+
+	/* scanner reports the same errors as Decode */
+	for _, s := range []string{`{"a" 1}`, `[1,2`, `1 2`, `{"a":}`} {
+		_, expect := Decode([]byte(s))
+		scanner = NewScanner([]byte(s))
+		var err error
+		for err == nil {
+			_, err = scanner.Next()
+		}
+		suite.Equal(expect, err, s)
+		_, err = scanner.Next()
+		suite.Equal(expect, err, s)
+	}
+	scanner = NewScannerWithOptions([]byte(`[1,]`), DecodeOptions{Strict: true})
+	scanner.Next()
+	scanner.Next()
+	_, err = scanner.Next()
+	suite.IsType(&SyntaxError{}, err)
+}
+
+func (suite *JSONTreeTestSuite) TestLazyDecode() {
+	lazy := DecodeOptions{Lazy: true}
+	tree, err := DecodeWithOptions([]byte(text1), lazy)
+	suite.NoError(err)
+	rows := tree.Root.GetObjectElemByKey("rows").Value
+	suite.NotNil(rows.lazy)
+	suite.Nil(rows.ArrayValues)
+	suite.Equal("OK", tree.Find("status").AsString())
+	suite.NotNil(rows.lazy)
+
+	/* marshal lazy node without decoding it */
+	eager, err := Decode([]byte(text1))
+	suite.NoError(err)
+	suite.Equal(eager.JSONString(), tree.JSONString())
+	suite.NotNil(rows.lazy)
+
+	suite.Equal(int64(365468), tree.Find("rows.0.elements.0.distance.value").AsInt())
+	suite.Nil(rows.lazy)
+	suite.Len(rows.ArrayValues, 1)
+	elements := tree.Find("rows.0.elements")
+	suite.NotNil(elements.ArrayValues[1].lazy)
+	suite.Len(elements.ArrayValues[1].Expand().ObjectValues, 3)
+
+	tree, _ = DecodeWithOptions([]byte(text1), lazy)
+	suite.True(tree.Equal(eager))
+	suite.Equal(eager.Root.Hash(), tree.Root.Hash())
+	tree, _ = DecodeWithOptions([]byte(text1), lazy)
+	suite.False(Diff(eager, tree).Exist())
+	tree, _ = DecodeWithOptions([]byte(text1), lazy)
+	suite.checkNode(tree.Root.ExpandAll())
+
+	/* lenient syntax in lazy span is normalized when marshaling */
+	data := `{"a":[1,,2 3],"b":{1:true "c":{}}}`
+	eager, _ = Decode([]byte(data))
+	tree, err = DecodeWithOptions([]byte(data), lazy)
+	suite.NoError(err)
+	out, _ := tree.MarshalJSON()
+	suite.Equal(`{"a":[1,2,3],"b":{1:true,"c":{}}}`, string(out))
+	expect, _ := eager.MarshalJSON()
+	suite.Equal(string(expect), string(out))
+	tree.Find("b").SetObjectIntElem("d", 1)
+	out, _ = tree.MarshalJSON()
+	suite.Equal(`{"a":[1,2,3],"b":{1:true,"c":{},"d":1}}`, string(out))
+
+	/* syntax errors in nested containers are still reported by decoding */
+	_, err = DecodeWithOptions([]byte(`{"a":{"b":[1,}}`), lazy)
+	suite.IsType(&SyntaxError{}, err)
+	_, err = DecodeWithOptions([]byte(`{"a":[1,]}`), DecodeOptions{Lazy: true, Strict: true})
+	suite.IsType(&SyntaxError{}, err)
+}
+
+func (suite *JSONTreeTestSuite) TestDecodeLimits() {
+	checkLimit := func(data string, opts DecodeOptions, limit string, path string) {
+		_, err := DecodeWithOptions([]byte(data), opts)
+		lerr, ok := err.(*LimitError)
+		if suite.True(ok, data) {
+			suite.Equal(limit, lerr.Limit, data)
+			suite.Equal(path, lerr.Path, data)
+		}
+		opts.Lazy = true
+		_, err = DecodeWithOptions([]byte(data), opts)
+		suite.IsType(&LimitError{}, err, data)
+	}
+	checkLimit(strings.Repeat("[", 100000)+strings.Repeat("]", 100000), DecodeOptions{MaxDepth: 64}, "MaxDepth", strings.TrimSuffix(strings.Repeat("0.", 64), "."))
+	checkLimit(`{"a":{"b.c":[{"d":{}}]}}`, DecodeOptions{MaxDepth: 4}, "MaxDepth", `a.b\.c.0.d`)
+	checkLimit(`{"a":[1,2,3]}`, DecodeOptions{MaxInputBytes: 12}, "MaxInputBytes", ``)
+	checkLimit(`{"a":[1,2],"b":[1,2,3]}`, DecodeOptions{MaxArrayLen: 2}, "MaxArrayLen", `b`)
+	checkLimit(`{"a":{"x":1,"y":2,"z":3}}`, DecodeOptions{MaxObjectKeys: 2}, "MaxObjectKeys", `a`)
+	checkLimit(`{"a":["abc","abcd"]}`, DecodeOptions{MaxStringLen: 3}, "MaxStringLen", `a.1`)
+	checkLimit(`{"abcd":1}`, DecodeOptions{MaxStringLen: 3, Strict: true}, "MaxStringLen", `abcd`)
+
+	opts := DecodeOptions{MaxDepth: 2, MaxInputBytes: 14, MaxArrayLen: 2, MaxObjectKeys: 1, MaxStringLen: 3}
+	tree, err := DecodeWithOptions([]byte(`{"a":[1,"xy"]}`), opts)
+	suite.NoError(err)
+	suite.Equal(`{"a":[1,"xy"]}`, tree.JSONString())
+
+	dec := NewDecoder(strings.NewReader(`[1] [1,2,3,4,5,6,7,8,9] [1]`)).SetOptions(DecodeOptions{MaxInputBytes: 8})
+	_, err = dec.Decode()
+	suite.NoError(err)
+	_, err = dec.Decode()
+	suite.IsType(&LimitError{}, err)
+	suite.Equal(4, err.(*LimitError).Offset)
+
+	scanner := NewScannerWithOptions([]byte(`[[1]]`), DecodeOptions{MaxDepth: 1})
+	scanner.Next()
+	_, err = scanner.Next()
+	suite.IsType(&LimitError{}, err)
+}
+
+func (suite *JSONTreeTestSuite) TestDecodeJSON5() {
+	input := `// service config
+{
+	name: 'qjson', /* inline */ "url": "http://example.com//path", // '//' in string is kept
+	$id_1: 0x1F, neg: -0xff, pos: +1, lead: .5, trail: 5., exp: 2e3,
+	inf: +Infinity, ninf: -Infinity, nan: NaN,
+	quote: 'say "hi"\'', esc: "\x41\v", 'multi': 'line \
+continued',
+	list: [1, 2, /* three */ 3,],
+	true: null,
+}
+`
+	opts := DecodeOptions{JSON5: true}
+	tree, err := DecodeWithOptions([]byte(input), opts)
+	suite.NoError(err)
+	suite.Equal(`qjson`, tree.Find("name").AsString())
+	suite.Equal(`http://example.com//path`, tree.Find("url").AsString())
+	suite.Equal(int64(31), tree.Find("$id_1").AsInt())
+	suite.Equal(int64(-255), tree.Find("neg").AsInt())
+	suite.Equal("1", tree.Find("pos").Value)
+	suite.Equal("0.5", tree.Find("lead").Value)
+	suite.Equal("5.0", tree.Find("trail").Value)
+	suite.Equal(Float, tree.Find("exp").Type)
+	suite.True(math.IsInf(tree.Find("inf").AsFloat(), 1))
+	suite.True(math.IsInf(tree.Find("ninf").AsFloat(), -1))
+	suite.True(math.IsNaN(tree.Find("nan").AsFloat()))
+	suite.Equal(`say "hi"'`, tree.Find("quote").AsString())
+	suite.Equal("A\v", tree.Find("esc").AsString())
+	suite.Equal("line continued", tree.Find("multi").AsString())
+	suite.Equal(`[1,2,3]`, tree.Find("list").AsTree().JSONString())
+	suite.Equal(Null, tree.Find("true").Type)
+	suite.Equal(`"true"`, tree.Root.ObjectValues[len(tree.Root.ObjectValues)-1].Key.Value)
+	data, err := tree.MarshalJSON()
+	suite.NoError(err)
+	suite.True(json.Valid(data), string(data))
+	suite.NotPanics(func() { tree.JSONString() })
+
+	/* json has no infinity or NaN, they are marshaled as null unless lossless mode keeps them */
+	tree, err = DecodeWithOptions([]byte(`[+Infinity, -Infinity, NaN, 1.5]`), opts)
+	suite.NoError(err)
+	suite.Equal(`[null,null,null,1.5]`, tree.JSONString())
+	tree.Root.ArrayValues[2].SetFloat(2, 1)
+	suite.Equal(`[null,null,2.0,1.5]`, tree.JSONString())
+	tree, err = DecodeWithOptions([]byte(`{inf: +Infinity, ninf: -Infinity, nan: NaN}`), DecodeOptions{JSON5: true, Lossless: true})
+	suite.NoError(err)
+	suite.True(math.IsInf(tree.Find("inf").AsFloat(), 1))
+	suite.True(math.IsInf(tree.Find("ninf").AsFloat(), -1))
+	suite.True(math.IsNaN(tree.Find("nan").AsFloat()))
+	data, _ = tree.MarshalJSON()
+	suite.Equal(`{inf: +Infinity, ninf: -Infinity, nan: NaN}`, string(data))
+
+	/* lazy spans are normalized when marshaling */
+	opts.Lazy = true
+	tree, err = DecodeWithOptions([]byte(`{a:{'b':[0x10, .5, 'x', +2, NaN]}, /* c */}`), opts)
+	suite.NoError(err)
+	data, _ = tree.MarshalJSON()
+	suite.Equal(`{"a":{"b":[16,0.5,"x",2,null]}}`, string(data))
+
+	/* raw control chars are escaped, line terminators must be escaped or continued */
+	opts.Lazy = false
+	tree, err = DecodeWithOptions([]byte("{a: \"x\ty\", 'b': 'line \\\r\ncontinued'}"), opts)
+	suite.NoError(err)
+	suite.Equal("x\ty", tree.Find("a").AsString())
+	suite.Equal("line continued", tree.Find("b").AsString())
+	data, _ = tree.MarshalJSON()
+	suite.True(json.Valid(data), string(data))
+	for _, s := range []string{"{a: \"x\ny\"}", "['x\ry']", "[\"x\r\n\"]"} {
+		_, err = DecodeWithOptions([]byte(s), opts)
+		suite.IsType(&SyntaxError{}, err, s)
+	}
+
+	/* strict JSON5 allows one trailing comma only */
+	opts = DecodeOptions{JSON5: true, Strict: true}
+	_, err = DecodeWithOptions([]byte(`{a:[1,],}`), opts)
+	suite.NoError(err)
+	for _, s := range []string{`[1,,]`, `[1 2]`, `{1:2}`, `{"a":1`, `'abc`, `/* open`, `[+]`, `{a:.}`} {
+		_, err = DecodeWithOptions([]byte(s), opts)
+		suite.IsType(&SyntaxError{}, err, s)
+	}
+	_, err = DecodeWithOptions([]byte(`{a:1} // comment`), DecodeOptions{})
+	suite.Error(err)
+
+	/* stream decoder skips comments between values */
+	stream := "// header\n{a:'}'} /* {[ */ [1,] 'str'// tail\n3/**/4 // end"
+	expects := []string{`{"a":"}"}`, `[1]`, `"str"`, `3`, `4`}
+	for _, r := range []io.Reader{strings.NewReader(stream), iotest.OneByteReader(strings.NewReader(stream))} {
+		dec := NewDecoder(r).SetOptions(DecodeOptions{JSON5: true})
+		var got []string
+		for dec.More() {
+			tree, err := dec.Decode()
+			suite.NoError(err)
+			data, _ := tree.MarshalJSON()
+			got = append(got, string(data))
+		}
+		suite.Equal(expects, got)
+	}
+}
+
+func (suite *JSONTreeTestSuite) TestDecodeCopy() {
+	input := `{"name":"abc","list":[1,{"k":"v"}]}`
+	overwrite := func(buf []byte) {
+		copy(buf, bytes.Replace(buf, []byte("abc"), []byte("xyz"), -1))
+		copy(buf, bytes.Replace(buf, []byte(`"v"`), []byte(`"w"`), -1))
+	}
+
+	buf := []byte(input)
+	tree, err := Decode(buf)
+	suite.NoError(err)
+	overwrite(buf)
+	/* default mode aliases input */
+	suite.Equal("xyz", tree.Find("name").AsString())
+
+	buf = []byte(input)
+	tree, err = DecodeWithOptions(buf, DecodeOptions{Copy: true})
+	suite.NoError(err)
+	overwrite(buf)
+	suite.Equal("abc", tree.Find("name").AsString())
+
+	for _, opts := range []DecodeOptions{{}, {Lazy: true}} {
+		buf = []byte(input)
+		tree, err = DecodeWithOptions(buf, opts)
+		suite.NoError(err)
+		suite.Equal(tree, tree.Detach())
+		overwrite(buf)
+		suite.Equal("abc", tree.Find("name").AsString())
+		suite.Equal(input, tree.JSONString())
+		suite.Equal("v", tree.Find("list.1.k").AsString())
+	}
+}
+
+func (suite *JSONTreeTestSuite) TestGet() {
+	jsonStr := `{
+  "name": {"first": "Tom", "last": "Anderson"},
+  "age":37,
+  "children": ["Sara","Alex","Jack"],
+  "fav.movie": "Deer Hunter",
+  "esc\"key": 1,
+  "friends": [
+    {"first": "Dale", "last": "Murphy", "age": 44, "nets": ["ig", "fb", "tw"]},
+    {"first": "Roger", "last": "Craig", "age": 68, "nets": ["fb", "tw"]},
+    {"first": "Jane", "last": "Murphy", "age": 47, "nets": ["ig", "tw"]}
+  ]
+}`
+	tree, err := Decode([]byte(jsonStr))
+	suite.NoError(err)
+	paths := []string{
+		"", "name", "name.last", "age", "children", "children.2", "children.3", `fav\.movie`, `esc"key`,
+		"friends.1", "friends.1.nets.0", "friends.#.first", "friends.#(nets.#(==\"fb\")).first", "friends.#(age>=47).first",
+		"none", "age.x", "name.0", "children.x", "friends.5.first",
+	}
+	for _, path := range paths {
+		node, err := Get([]byte(jsonStr), path)
+		suite.NoError(err, path)
+		expect := tree.Find(path)
+		if expect == nil {
+			suite.Nil(node, path)
+			continue
+		}
+		suite.True(expect.Equal(node), path)
+	}
+
+	/* only bytes walked through are validated */
+	node, err := Get([]byte(`{"a":1,"b":[}`), "a")
+	suite.NoError(err)
+	suite.Equal(int64(1), node.AsInt())
+	_, err = Get([]byte(`{"a":[1,}],"b":2}`), "b")
+	suite.IsType(&SyntaxError{}, err)
+	_, err = Get([]byte(`{}`), "#(")
+	suite.Error(err)
+	node, err = Get(nil, "a")
+	suite.NoError(err)
+	suite.Nil(node)
+}
+
+func (suite *JSONTreeTestSuite) TestDeepNesting() {
+	const depth = 100000
+	deepArray := strings.Repeat("[", depth) + "1" + strings.Repeat("]", depth)
+	deepObject := strings.Repeat(`{"a":`, depth) + "1" + strings.Repeat("}", depth)
+	for _, input := range []string{deepArray, deepObject} {
+		for _, opts := range []DecodeOptions{{}, {Strict: true}} {
+			tree1, err := DecodeWithOptions([]byte(input), opts)
+			suite.NoError(err)
+			data, err := tree1.MarshalJSON()
+			suite.NoError(err)
+			suite.Equal(input, string(data))
+
+			tree2, err := Decode([]byte(strings.Replace(input, "1", "2", 1)))
+			suite.NoError(err)
+			suite.NotEqual(tree1.Root.Rehash(), tree2.Root.Rehash())
+			suite.False(tree1.Equal(tree2))
+			diffs := Diff(tree1, tree2)
+			suite.Len(diffs, 1)
+			suite.Equal(depth, strings.Count(diffs[0].Path, ".")+1)
+
+			tree2, err = Decode([]byte(input))
+			suite.NoError(err)
+			suite.Equal(tree1.Root.Rehash(), tree2.Root.Rehash())
+			suite.True(tree1.Equal(tree2))
+			suite.False(Diff(tree1, tree2).Exist())
+			suite.NoError(tree1.CheckShared())
+		}
+	}
+	tree1, err := Decode([]byte(deepArray))
+	suite.NoError(err)
+	leaf := tree1.Root
+	for leaf.Type == Array {
+		leaf = leaf.ArrayValues[0]
+	}
+	tree1.Root.AddArrayElem(leaf)
+	var se *SharedNodeError
+	suite.True(errors.As(tree1.CheckShared(), &se))
+	suite.ElementsMatch([]string{"1", strings.TrimSuffix(strings.Repeat("0.", depth), ".")}, []string{se.Path, se.OtherPath})
+
+	/* containers beyond recursion limit are written with stack */
+	mixed := strings.Repeat(`{"k":null,"a":[true,"x",{},[],`, 1000) + "1" + strings.Repeat("]}", 1000)
+	tree, err := Decode([]byte(mixed))
+	suite.NoError(err)
+	data, err := tree.MarshalJSON()
+	suite.NoError(err)
+	suite.Equal(mixed, string(data))
+}
+
+func (suite *JSONTreeTestSuite) TestEqualArray() {
+	tree1, _ := Decode([]byte(`[1,null,{"a":[2]}]`))
+	tree2, _ := Decode([]byte(`[1,{"a":[2]}]`))
+	tree3, _ := Decode([]byte(`[1,{"a":[3]}]`))
+	suite.True(tree1.Equal(tree2))
+	suite.False(tree1.Equal(tree3))
+	suite.False(tree3.Equal(tree1))
+}
+
+func (suite *JSONTreeTestSuite) TestNodePositions() {
+	input := "{\n  \"name\": \"é\", \"port\": 80,\n  \"list\": [true, {\"a\": null}]\n}"
+	for _, opts := range []DecodeOptions{{Positions: true}, {Positions: true, Lazy: true}} {
+		tree, err := DecodeWithOptions([]byte(input), opts)
+		suite.NoError(err)
+		suite.Equal(Pos{Offset: 0, End: len(input), Line: 1, Column: 1}, tree.Root.Pos())
+		suite.Equal(Pos{Offset: 12, End: 16, Line: 2, Column: 11}, tree.Find("name").Pos())
+		port := tree.Find("port").Pos()
+		suite.Equal("2:24", port.String())
+		suite.Equal("80", input[port.Offset:port.End])
+		suite.Equal(Pos{Offset: 40, End: 59, Line: 3, Column: 11}, tree.Find("list").Pos())
+		suite.Equal(Pos{Offset: 47, End: 58, Line: 3, Column: 18}, tree.Find("list.1").Pos())
+		suite.Equal(Pos{Offset: 53, End: 57, Line: 3, Column: 24}, tree.Find("list.1.a").Pos())
+		suite.Equal(Pos{Offset: 48, End: 51, Line: 3, Column: 19}, tree.Find("list.1").ObjectValues[0].Key.Pos())
+	}
+	tree, err := Decode([]byte(input))
+	suite.NoError(err)
+	suite.False(tree.Find("name").Pos().IsValid())
+	suite.False(CreateNode().Pos().IsValid())
+
+	/* positions of stream values are relative to the stream */
+	dec := NewDecoder(strings.NewReader("1\n [\"x\",\n2]")).SetOptions(DecodeOptions{Positions: true})
+	dec.Decode()
+	tree, err = dec.Decode()
+	suite.NoError(err)
+	suite.Equal(Pos{Offset: 3, End: 11, Line: 2, Column: 2}, tree.Root.Pos())
+	suite.Equal(Pos{Offset: 9, End: 10, Line: 3, Column: 1}, tree.Find("1").Pos())
+}
+
+func (suite *JSONTreeTestSuite) TestDuplicateKeys() {
+	input := `{"a":1,"b":{"c":true},"a":[2],"b":{"d":null},"e":{"a":1,"b":2}}`
+	tree, err := DecodeWithOptions([]byte(input), DecodeOptions{})
+	suite.NoError(err)
+	suite.Len(tree.Root.ObjectValues, 5)
+
+	_, err = DecodeWithOptions([]byte(input), DecodeOptions{DuplicateKeys: DuplicateKeysError})
+	suite.Equal(&DuplicateKeyError{Key: "a", Path: "a", Offset: 22}, err)
+	_, err = DecodeWithOptions([]byte(`{"x":[{"k":1,"k":2}]}`), DecodeOptions{DuplicateKeys: DuplicateKeysError, Lazy: true})
+	suite.Equal(&DuplicateKeyError{Key: "k", Path: "x.0.k", Offset: 13}, err)
+	_, err = DecodeWithOptions([]byte(`[{"k":1},{"k":2}]`), DecodeOptions{DuplicateKeys: DuplicateKeysError})
+	suite.NoError(err)
+	_, err = DecodeWithOptions([]byte(`{"a":1,"\u0061":2}`), DecodeOptions{DuplicateKeys: DuplicateKeysError})
+	suite.IsType(&DuplicateKeyError{}, err)
+
+	expects := map[DuplicateKeys]string{
+		DuplicateKeysKeepFirst: `{"a":1,"b":{"c":true},"e":{"a":1,"b":2}}`,
+		DuplicateKeysKeepLast:  `{"a":[2],"b":{"d":null},"e":{"a":1,"b":2}}`,
+	}
+	for policy, expect := range expects {
+		for _, lazy := range []bool{false, true} {
+			tree, err = DecodeWithOptions([]byte(`{"x":`+input+`}`), DecodeOptions{DuplicateKeys: policy, Lazy: lazy})
+			suite.NoError(err, policy.String())
+			data, _ := tree.MarshalJSON()
+			suite.Equal(`{"x":`+expect+`}`, string(data), policy.String())
+			/* all APIs agree */
+			node := tree.Find("x")
+			suite.Equal(node.AsMap()["a"].AsJSON(), node.GetObjectElemByKey("a").Value.AsJSON())
+			expectTree, _ := Decode([]byte(expect))
+			suite.True(expectTree.Root.Equal(node))
+			suite.False(Diff(expectTree, node.AsTree()).Exist())
+		}
+	}
+}
+
+func (suite *JSONTreeTestSuite) TestBigNumbers() {
+	tree, err := Decode([]byte(`{"id":340282366920938463463374607431768211455,"amount":12.30,"exp":-1.50e2,"tiny":1e-3,"zero":-0.0,"big":1e30,"s":"1"}`))
+	suite.NoError(err)
+	id, err := tree.Find("id").AsBigInt()
+	suite.NoError(err)
+	suite.Equal("340282366920938463463374607431768211455", id.String())
+	suite.Equal(json.Number("12.30"), tree.Find("amount").AsNumber())
+	i, err := tree.Find("exp").AsBigInt()
+	suite.NoError(err)
+	suite.Equal(int64(-150), i.Int64())
+	_, err = tree.Find("amount").AsBigInt()
+	suite.Error(err)
+	_, err = tree.Find("s").AsBigInt()
+	suite.IsType(&TypeError{}, err)
+	/* untrusted exponent can't force a huge integer */
+	_, err = CreateFloatNode().SetRawValue("1e999999999").AsBigInt()
+	suite.True(errors.Is(err, strconv.ErrRange))
+	i, err = CreateFloatNode().SetRawValue("1e1000").AsBigInt()
+	suite.NoError(err)
+	suite.Equal(1001, len(i.String()))
+	f, err := tree.Find("id").AsBigFloat()
+	suite.NoError(err)
+	suite.Equal("340282366920938463463374607431768211455", f.Text('f', 0))
+	f, err = tree.Find("big").AsBigFloat()
+	suite.NoError(err)
+	suite.Equal(new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(30), nil)).String(), f.String())
+
+	for path, expect := range map[string]string{"id": "340282366920938463463374607431768211455", "amount": "12.3", "exp": "-150", "tiny": "0.001", "zero": "0", "big": "1" + strings.Repeat("0", 30)} {
+		d, err := tree.Find(path).AsDecimal()
+		suite.NoError(err)
+		suite.Equal(expect, d, path)
+	}
+	_, err = tree.Find("s").AsDecimal()
+	suite.Error(err)
+	suite.Panics(func() { tree.Find("s").AsNumber() })
+
+	n := CreateNode().SetBigInt(id.Add(id, big.NewInt(1)))
+	suite.Equal(Integer, n.Type)
+	suite.Equal("340282366920938463463374607431768211456", n.AsJSON())
+	suite.Equal(Float, n.SetNumber("0.10").Type)
+	suite.Equal("0.10", n.Value)
+	suite.Equal(Integer, n.SetNumber("-7").Type)
+	suite.Panics(func() { n.SetNumber("1x") })
+	suite.Panics(func() { n.SetNumber("") })
+}
+
+func (suite *JSONTreeTestSuite) TestInputEncoding() {
+	input := `{"name":"é😀","list":[1]}`
+	utf16Units := utf16.Encode([]rune(input))
+	utf16LE, utf16BE := make([]byte, 2*len(utf16Units)), make([]byte, 2*len(utf16Units))
+	for i, u := range utf16Units {
+		binary.LittleEndian.PutUint16(utf16LE[2*i:], u)
+		binary.BigEndian.PutUint16(utf16BE[2*i:], u)
+	}
+	var utf32LE, utf32BE []byte
+	for _, r := range input {
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], uint32(r))
+		utf32LE = append(utf32LE, b[:]...)
+		binary.BigEndian.PutUint32(b[:], uint32(r))
+		utf32BE = append(utf32BE, b[:]...)
+	}
+	encoded := [][]byte{
+		append([]byte{0xEF, 0xBB, 0xBF}, input...),
+		utf16LE, utf16BE, utf32LE, utf32BE,
+		append([]byte{0xFF, 0xFE}, utf16LE...),
+		append([]byte{0xFE, 0xFF}, utf16BE...),
+		append([]byte{0xFF, 0xFE, 0, 0}, utf32LE...),
+		append([]byte{0, 0, 0xFE, 0xFF}, utf32BE...),
+	}
+	for i, data := range encoded {
+		tree, err := DecodeWithOptions(data, DecodeOptions{DetectEncoding: true, Lazy: true})
+		suite.NoError(err, i)
+		suite.Equal("é😀", tree.Find("name").AsString())
+		suite.Equal(input, tree.JSONString())
+		_, err = Decode(data)
+		suite.Error(err, i)
+	}
+	tree, err := DecodeWithOptions([]byte("1\x00"), DecodeOptions{DetectEncoding: true})
+	suite.NoError(err)
+	suite.Equal(int64(1), tree.Root.AsInt())
+
+	dec := NewDecoder(strings.NewReader("\xEF\xBB\xBF1 2")).SetOptions(DecodeOptions{DetectEncoding: true})
+	for _, expect := range []int64{1, 2} {
+		tree, err = dec.Decode()
+		suite.NoError(err)
+		suite.Equal(expect, tree.Root.AsInt())
+	}
+
+	/* invalid UTF-8 */
+	invalid := []byte("{\"a\xff\":\"b\xc3\x28\",\"c\":[\"\xed\xa0\x80\"]}")
+	tree, err = Decode(invalid)
+	suite.NoError(err)
+	suite.Equal("\"b\xc3\x28\"", tree.Root.ObjectValues[0].Value.Value)
+	_, err = DecodeWithOptions(invalid, DecodeOptions{InvalidUTF8: InvalidUTF8Error})
+	suite.Equal(3, err.(*SyntaxError).Offset)
+	suite.Equal(expectValidUTF8, err.(*SyntaxError).Expect)
+	for _, opts := range []DecodeOptions{{InvalidUTF8: InvalidUTF8Replace}, {InvalidUTF8: InvalidUTF8Replace, Lazy: true}} {
+		tree, err = DecodeWithOptions(invalid, opts)
+		suite.NoError(err)
+		suite.Equal("b�(", tree.Find("a�").AsString())
+		suite.Equal("���", tree.Find("c.0").AsString())
+		data, _ := tree.MarshalJSON()
+		var expect interface{}
+		suite.NoError(json.Unmarshal(invalid, &expect))
+		var got interface{}
+		suite.NoError(json.Unmarshal(data, &got))
+		suite.Equal(expect, got)
+		suite.True(utf8.Valid(data))
+	}
+}
+
+func (suite *JSONTreeTestSuite) TestLossless() {
+	input := "\n{\n  \"name\" : \"qjson\",\n  \"tags\": [\"a\", \"b\"],\n  \"server\": {\n    \"host\": \"localhost\"\n  },\n  \"list\": [\n  ],\n  \"empty\": {}\n}\n"
+	for _, lazy := range []bool{false, true} {
+		tree, err := DecodeWithOptions([]byte(input), DecodeOptions{Lossless: true, Lazy: lazy, Positions: true})
+		suite.NoError(err)
+		data, _ := tree.MarshalJSON()
+		suite.Equal(input, string(data))
+		suite.Equal(`{"host":"localhost"}`, tree.Find("server").AsJSON())
+
+		tree.Find("server.host").SetString("127.0.0.1")
+		tree.Find("server").SetObjectIntElem("port", 80)
+		tree.Find("tags").AddArrayElem(CreateStringNode().SetString("c"))
+		tree.Find("list").AddArrayElem(CreateIntegerNode().SetInt(1))
+		tree.Find("empty").SetObjectBoolElem("ok", true)
+		tree.Remove("name")
+		tree.Root.SetObjectNodeElem("last", CreateNode())
+		data, _ = tree.MarshalJSON()
+		suite.Equal("\n{\n  \"tags\": [\"a\", \"b\", \"c\"],\n  \"server\": {\n    \"host\": \"127.0.0.1\",\n    \"port\": 80\n  },\n  \"list\": [\n    1\n  ],\n  \"empty\": {\"ok\": true},\n  \"last\": null\n}\n", string(data))
+		suite.Equal(`{"tags":["a","b","c"],"server":{"host":"127.0.0.1","port":80},"list":[1],"empty":{"ok":true},"last":null}`, tree.JSONString())
+	}
+
+	/* comments and JSON5 syntax are kept too */
+	input = "// config\r\n{\r\n\ta: 0x10, // hex\r\n\t'b': [1, 2,],\r\n\t/* c */ c: +1,\r\n}"
+	tree, err := DecodeWithOptions([]byte(input), DecodeOptions{Lossless: true, JSON5: true, Copy: true})
+	suite.NoError(err)
+	data, _ := tree.MarshalJSON()
+	suite.Equal(input, string(data))
+	suite.Equal(int64(16), tree.Find("a").AsInt())
+	tree.Find("c").SetInt(2)
+	tree.Root.SetObjectStringElem("d", "x")
+	data, _ = tree.Detach().MarshalJSON()
+	suite.Equal("// config\r\n{\r\n\ta: 0x10, // hex\r\n\t'b': [1, 2,],\r\n\t/* c */ c: 2,\r\n\t\"d\": \"x\",\r\n}", string(data))
+
+	/* dropped duplicate keys take their text away */
+	tree, err = DecodeWithOptions([]byte(`{"a": 1, "a": 2, "b": 3}`), DecodeOptions{Lossless: true, DuplicateKeys: DuplicateKeysKeepFirst})
+	suite.NoError(err)
+	data, _ = tree.MarshalJSON()
+	suite.Equal(`{"a": 1, "b": 3}`, string(data))
+
+	/* lossless container keeps its text under a plain parent */
+	plain := New()
+	plain.Root = CreateObjectNode()
+	plain.Root.SetObjectNodeElem("x", tree.Root)
+	plain.Root.SetObjectNodeElem("y", CreateArrayNode().AddArrayElem(CreateIntegerNode().SetInt(1)))
+	data, _ = plain.MarshalJSON()
+	suite.Equal(`{"x":{"a": 1, "b": 3},"y":[1]}`, string(data))
+}
+
+func (suite *JSONTreeTestSuite) TestDecodeParallel() {
+	var sb strings.Builder
+	sb.WriteString(" [")
+	for i := 0; i < 5000; i++ {
+		if i > 0 {
+			sb.WriteString(",\n")
+		}
+		fmt.Fprintf(&sb, `{"id":%d,"name":"a,b]\"}[","tags":[1,2.5,null,true],"nested":{"x":[{}]}}`, i)
+		sb.WriteString(`, "s\\` + strconv.Itoa(i) + `\"" ,[] `)
+	}
+	sb.WriteString("] ")
+	data := []byte(sb.String())
+	expect, err := Decode(data)
+	suite.NoError(err)
+	expectJSON, _ := expect.MarshalJSON()
+	bounds, ok := splitArray(data, 4)
+	suite.True(ok)
+	suite.Len(bounds, 5)
+	for _, workers := range []int{0, 1, 2, 3, 8, 100} {
+		tree, err := DecodeParallel(data, workers)
+		suite.NoError(err)
+		suite.Len(tree.Root.ArrayValues, 15000)
+		suite.True(expect.Equal(tree))
+		actualJSON, _ := tree.MarshalJSON()
+		suite.Equal(string(expectJSON), string(actualJSON))
+	}
+
+	/* errors are the same as Decode */
+	for _, bad := range []string{
+		strings.Replace(sb.String(), `"id":4000`, `"id":4000}`, 1),
+		strings.Replace(sb.String(), `"id":4000`, `"id"4000`, 1),
+		sb.String() + "x",
+		sb.String()[:len(sb.String())-2],
+	} {
+		_, expectErr := Decode([]byte(bad))
+		suite.Error(expectErr)
+		_, err := DecodeParallel([]byte(bad), 4)
+		suite.Equal(expectErr, err)
+	}
+
+	/* small or non-array input */
+	tree, err := DecodeParallel([]byte(`[1,2]`), 4)
+	suite.NoError(err)
+	suite.Equal(`[1,2]`, tree.JSONString())
+	tree, err = DecodeParallel([]byte(`{"a":1}`), 4)
+	suite.NoError(err)
+	suite.Equal(`{"a":1}`, tree.JSONString())
+}
+
+func (suite *JSONTreeTestSuite) TestTryAccessors() {
+	tree, err := Decode([]byte(`{"s":"str","i":-1,"u":18446744073709551615,"f":1.5,"b":true,"n":null,"o":{"a.b":1},"l":[1]}`))
+	suite.NoError(err)
+
+	s, err := tree.GetString("s")
+	suite.NoError(err)
+	suite.Equal("str", s)
+	i, err := tree.GetInt("i")
+	suite.NoError(err)
+	suite.Equal(int64(-1), i)
+	u, err := tree.GetUint("u")
+	suite.NoError(err)
+	suite.Equal(uint64(math.MaxUint64), u)
+	f, err := tree.GetFloat("f")
+	suite.NoError(err)
+	suite.Equal(1.5, f)
+	b, err := tree.GetBool("b")
+	suite.NoError(err)
+	suite.True(b)
+	i, err = tree.GetInt(`o.a\.b`)
+	suite.NoError(err)
+	suite.Equal(int64(1), i)
+
+	_, err = tree.GetInt("s")
+	suite.Equal(&TypeError{Path: "s", Expected: []NodeType{Integer}, Actual: String}, err)
+	suite.Equal(`node type at path "s" is String, expect Integer`, err.Error())
+	_, err = tree.GetString("o")
+	suite.Equal(`node type at path "o" is Object, expect String or Bool or Integer or Float`, err.Error())
+	_, err = tree.GetFloat("l.0")
+	suite.Equal(&TypeError{Path: "l.0", Expected: []NodeType{Float}, Actual: Integer}, err)
+	_, err = tree.GetInt("u")
+	suite.True(errors.Is(err, strconv.ErrRange))
+	suite.Contains(err.Error(), `at path "u"`)
+	_, err = tree.GetBool("missing.b")
+	suite.Equal(&NotFoundError{Path: "missing.b"}, err)
+	_, err = tree.GetNode("l.#(a")
+	suite.Error(err)
+
+	suite.Equal(int64(7), tree.GetIntOr("missing", 7))
+	suite.Equal(int64(7), tree.GetIntOr("n", 7))
+	suite.Equal(int64(-1), tree.GetIntOr("i", 7))
+	suite.Equal(uint64(7), tree.GetUintOr("i", 7))
+	suite.Equal("def", tree.GetStringOr("l", "def"))
+	suite.Equal("1.5", tree.GetStringOr("f", "def"))
+	suite.Equal(2.5, tree.GetFloatOr("i", 2.5))
+	suite.True(tree.GetBoolOr("s", true))
+	var nilTree *JSONTree
+	suite.Equal(int64(7), nilTree.GetIntOr("a", 7))
+
+	/* node accessors */
+	_, err = tree.Find("s").TryAsBool()
+	suite.Equal(`node type is String, expect Bool`, err.Error())
+	_, err = tree.Find("l").TryAsMap()
+	suite.Equal(&TypeError{Expected: []NodeType{Object, Null}, Actual: Array}, err)
+	_, err = tree.Find("l").TryGetObjectElemByKey("a")
+	suite.Error(err)
+	_, err = tree.Find("l").TryRemoveObjectElemByKey("a")
+	suite.Error(err)
+	elem, err := tree.Find("o").TryGetObjectElemByKey("x")
+	suite.NoError(err)
+	suite.Nil(elem)
+	ok, err := tree.Find("o").TryRemoveObjectElemByKey("a.b")
+	suite.NoError(err)
+	suite.True(ok)
+	suite.Panics(func() { tree.Find("s").AsInt() })
+	suite.Equal(String.String(), "String")
+}
+
+func (suite *JSONTreeTestSuite) TestCoercion() {
+	tree, err := Decode([]byte(`{"qi":"42","qf":"-1.5e1","f":12.0,"e":1.2e1,"frac":12.5,"big":12345678901234567890,"t":true,"st":"true","one":1,"two":2,"n":null,"o":{}}`))
+	suite.NoError(err)
+	for path, expect := range map[string]int64{"qi": 42, "qf": -15, "f": 12, "e": 12, "t": 1, "one": 1} {
+		i, err := tree.Find(path).ToInt()
+		suite.NoError(err, path)
+		suite.Equal(expect, i, path)
+	}
+	_, err = tree.Find("frac").ToInt()
+	suite.True(errors.Is(err, ErrLossyConversion))
+	_, err = tree.Find("big").ToInt()
+	suite.True(errors.Is(err, strconv.ErrRange))
+	u, err := tree.Find("big").ToUint()
+	suite.NoError(err)
+	suite.Equal(uint64(12345678901234567890), u)
+	_, err = tree.Find("qf").ToUint()
+	suite.True(errors.Is(err, strconv.ErrRange))
+	_, err = tree.Find("n").ToInt()
+	suite.Equal(&TypeError{Expected: []NodeType{Integer, Float, String, Bool}, Actual: Null}, err)
+	_, err = tree.Find("o").ToFloat()
+	suite.Error(err)
+
+	f, err := tree.Find("qi").ToFloat()
+	suite.NoError(err)
+	suite.Equal(42.0, f)
+	_, err = tree.Find("big").ToFloat()
+	suite.True(errors.Is(err, ErrLossyConversion))
+
+	for path, expect := range map[string]bool{"t": true, "st": true, "one": true, "f": false} {
+		if path == "f" {
+			_, err := tree.Find(path).ToBool()
+			suite.True(errors.Is(err, ErrLossyConversion))
+			continue
+		}
+		b, err := tree.Find(path).ToBool()
+		suite.NoError(err, path)
+		suite.Equal(expect, b, path)
+	}
+	_, err = tree.Find("qi").ToBool()
+	suite.Error(err)
+
+	for path, expect := range map[string]string{"qi": "42", "e": "1.2e1", "t": "true"} {
+		s, err := tree.Find(path).ToString()
+		suite.NoError(err)
+		suite.Equal(expect, s)
+	}
+	_, err = tree.Find("n").ToString()
+	suite.Error(err)
+
+	/* custom rules */
+	strict := Coercion{}
+	_, err = strict.ToInt(tree.Find("qi"))
+	suite.Equal(&TypeError{Expected: []NodeType{Integer, Float}, Actual: String}, err)
+	_, err = strict.ToBool(tree.Find("one"))
+	suite.Equal(&TypeError{Expected: []NodeType{Bool}, Actual: Integer}, err)
+	lossy := Coercion{Lossy: true, NullAsZero: true, NumberToBool: true}
+	i, err := lossy.ToInt(tree.Find("frac"))
+	suite.NoError(err)
+	suite.Equal(int64(12), i)
+	i, err = lossy.ToInt(tree.Find("n"))
+	suite.NoError(err)
+	suite.Equal(int64(0), i)
+	b, err := lossy.ToBool(tree.Find("two"))
+	suite.NoError(err)
+	suite.True(b)
+	s, err := lossy.ToString(tree.Find("n"))
+	suite.NoError(err)
+	suite.Equal("", s)
+
+	/* number filters compare integers with floats */
+	tree, err = Decode([]byte(`[{"age":47},{"age":47.5},{"age":1e2},{"age":9223372036854775807}]`))
+	suite.NoError(err)
+	suite.Equal(`[47.5,1e2,9223372036854775807]`, tree.Find("#(age>47).age").AsJSON())
+	suite.Equal(`[47,47.5]`, tree.Find("#(age<=47.5).age").AsJSON())
+	suite.Equal(`[47,47.5,1e2]`, tree.Find("#(age<9223372036854775807).age").AsJSON())
+	suite.Equal(`[47.5,1e2,9223372036854775807]`, tree.Find("#(age>=47.1).age").AsJSON())
+}
+
+func (suite *JSONTreeTestSuite) TestKeyIndex() {
+	var sb strings.Builder
+	sb.WriteString(`{"dup":-1,"esc\u0061ped":-2`)
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&sb, `,"k%d":%d`, i, i)
+	}
+	sb.WriteString(`,"dup":-3}`)
+	tree, err := DecodeWithOptions([]byte(sb.String()), DecodeOptions{Copy: true})
+	suite.NoError(err)
+	root := tree.Root
+
+	/* concurrent reads build index */
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				suite.Equal(int64(i), tree.Find("k"+strconv.Itoa(i)).AsInt())
+			}
+		}()
+	}
+	wg.Wait()
+	suite.NotNil(root.loadIndex())
+	suite.Equal(int64(-1), tree.Find("dup").AsInt())
+	suite.Equal(int64(-2), tree.Find("escaped").AsInt())
+	suite.Nil(tree.Find("missing"))
+
+	/* index is maintained by appends */
+	root.SetObjectIntElem("new", 1000)
+	root.SetObjectIntElem("k5", 5000)
+	suite.True(root.loadIndex().valid(root.ObjectValues))
+	suite.Equal(int64(1000), tree.Find("new").AsInt())
+	suite.Equal(int64(5000), tree.Find("k5").AsInt())
+
+	/* and rebuilt after removing or direct modifying */
+	suite.True(root.RemoveObjectElemByKey("dup"))
+	suite.Nil(tree.Find("dup"))
+	suite.Equal(int64(99), tree.Find("k99").AsInt())
+	root.ObjectValues = append(root.ObjectValues, &ObjectElem{Key: CreateStringNodeWithValue("direct"), Value: CreateIntegerNode().SetInt(1)})
+	suite.Equal(int64(1), tree.Find("direct").AsInt())
+	root.ObjectValues[0].Key.SetString("renamed")
+	root.Reindex()
+	suite.Nil(tree.Find("escaped"))
+	suite.Equal(`-2`, tree.Find("renamed").AsJSON())
+	/* keys and elements modified in place after the index is built are seen after Reindex */
+	suite.Equal(int64(3), tree.Find("k3").AsInt())
+	root.ObjectValues[4].Key.SetString("zz")
+	suite.Nil(tree.Find("zz"))
+	root.Reindex()
+	suite.Equal(int64(3), tree.Find("zz").AsInt())
+	suite.Equal(int64(3), root.GetObjectElemByKey("zz").Value.AsInt())
+	suite.Nil(tree.Find("k3"))
+	root.ObjectValues[5] = &ObjectElem{Key: CreateStringNode().SetString("yy"), Value: CreateIntegerNode().SetInt(4)}
+	root.Reindex()
+	suite.Equal(int64(4), tree.Find("yy").AsInt())
+	suite.Nil(tree.Find("k4"))
+	suite.Equal(int64(7), tree.Detach().Find("k7").AsInt())
+	suite.Len(root.ObjectValues, 103)
+}
+
+func (suite *JSONTreeTestSuite) TestSetByPath() {
+	tree := New()
+	suite.NoError(tree.Set("data.user.name", "Jack"))
+	suite.NoError(tree.Set("data.user.tags.1", "b"))
+	suite.NoError(tree.Set("data.user.tags.0", "a"))
+	suite.NoError(tree.Set("data.items.0.id", 1))
+	suite.NoError(tree.Set("data.items.1", map[string]int{"id": 2}))
+	suite.NoError(tree.Set(`data.fav\.movie`, nil))
+	suite.NoError(tree.SetNode("data.ok", CreateBoolNode().SetBool(true)))
+	suite.Equal(`{"data":{"user":{"name":"Jack","tags":["a","b"]},"items":[{"id":1},{"id":2}],"fav.movie":null,"ok":true}}`, tree.JSONString())
+
+	/* existing values are replaced, null is turned into container */
+	suite.NoError(tree.Set("data.user.name", "Tom"))
+	suite.NoError(tree.Set(`data.fav\.movie.title`, "Up"))
+	suite.Equal("Tom", tree.Find("data.user.name").AsString())
+	suite.Equal("Up", tree.Find(`data.fav\.movie.title`).AsString())
+	suite.NoError(tree.Set("data.items.1.id", 3))
+	suite.Equal(int64(3), tree.Find("data.items.1.id").AsInt())
+
+	/* numeric segment of existing object is a key */
+	suite.NoError(tree.Set("data.user.0", "zero"))
+	suite.Equal("zero", tree.Find("data.user.0").AsString())
+
+	var te *TypeError
+	err := tree.Set("data.user.name.first", "J")
+	suite.True(errors.As(err, &te))
+	suite.Equal("data.user.name", te.Path)
+	suite.Equal(String, te.Actual)
+	suite.Error(tree.Set("data.items.x", 1))
+	suite.Error(tree.Set("data.items.#.id", 1))
+	suite.Equal("Tom", tree.Find("data.user.name").AsString())
+
+	/* arrays are padded with null, empty path replace root */
+	tree2, err := Decode([]byte(`{"a":[1]}`))
+	suite.NoError(err)
+	suite.NoError(tree2.Set("a.3", 4))
+	suite.Equal(`{"a":[1,null,null,4]}`, tree2.JSONString())
+	suite.NoError(tree2.Set("", tree))
+	suite.Equal(tree.JSONString(), tree2.JSONString())
+
+	/* floats are formatted like encoding/json, unsupported types are errors instead of null */
+	tree4 := New()
+	for i, f := range []float64{2.5, 3.0, 1e-7, 1e21, -0.000001, 123456789.125} {
+		suite.NoError(tree4.Set(strconv.Itoa(i), f))
+	}
+	suite.Equal(`[2.5,3,1e-7,1e+21,-0.000001,123456789.125]`, tree4.JSONString())
+	expected, err := Decode(JSONMarshalWithPanic([]float64{2.5, 3.0, 1e-7, 1e21, -0.000001, 123456789.125}))
+	suite.NoError(err)
+	suite.True(expected.Equal(tree4))
+	conv, err := ConvertToJSONTree(struct{ X float64 }{X: 0.5})
+	suite.NoError(err)
+	suite.Equal(`{"X":0.5}`, conv.JSONString())
+	for _, v := range []interface{}{complex(1, 2), func() {}, make(chan int)} {
+		var ute *json.UnsupportedTypeError
+		suite.True(errors.As(tree4.Set("x", v), &ute))
+	}
+	suite.Nil(tree4.Find("x"))
+
+	tree3, err := DecodeWithOptions([]byte(`{"a":{"b":{}}}`), DecodeOptions{Lazy: true})
+	suite.NoError(err)
+	suite.NoError(tree3.Set("a.b.c", []int{1}))
+	suite.Equal(`{"a":{"b":{"c":[1]}}}`, tree3.JSONString())
+}
+
+func (suite *JSONTreeTestSuite) TestReorderElems() {
+	tree, err := Decode([]byte(`{"a":1,"b":2,"c":3,"list":[0,1,2,3,4]}`))
+	suite.NoError(err)
+	list := tree.Find("list")
+	suite.True(list.InsertArrayElem(0, CreateIntegerNode().SetInt(-1)))
+	suite.True(list.InsertArrayElem(6, CreateIntegerNode().SetInt(5)))
+	suite.False(list.InsertArrayElem(8, CreateNode()))
+	suite.Equal(`[-1,0,1,2,3,4,5]`, list.AsJSON())
+	removed := list.Splice(1, 2, CreateStringNode().SetString("x"))
+	suite.Len(removed, 2)
+	suite.Equal(`0`, removed[0].AsJSON())
+	suite.Equal(`1`, removed[1].AsJSON())
+	suite.Equal(`[-1,"x",2,3,4,5]`, list.AsJSON())
+	suite.Len(list.Splice(5, 10), 1)
+	suite.Len(list.Splice(-1, 0, CreateNode()), 0)
+	suite.Equal(`[null,-1,"x",2,3,4]`, list.AsJSON())
+	suite.True(list.MoveArrayElem(0, 5))
+	suite.Equal(`[-1,"x",2,3,4,null]`, list.AsJSON())
+	suite.True(list.MoveArrayElem(4, 1))
+	suite.Equal(`[-1,4,"x",2,3,null]`, list.AsJSON())
+	suite.False(list.MoveArrayElem(0, 6))
+
+	root := tree.Root
+	elem := CreateObjectElem()
+	elem.Key, elem.Value = CreateStringNode().SetString("x"), CreateIntegerNode().SetInt(0)
+	suite.True(root.InsertObjectElemBefore("a", elem))
+	elem = CreateObjectElem()
+	elem.Key, elem.Value = CreateStringNode().SetString("y"), CreateIntegerNode().SetInt(9)
+	suite.True(root.InsertObjectElemAfter("b", elem))
+	suite.False(root.InsertObjectElemAfter("missing", elem))
+	suite.True(root.RenameObjectKey("a", "A"))
+	suite.False(root.RenameObjectKey("b", "c"))
+	suite.False(root.RenameObjectKey("missing", "z"))
+	suite.Equal(`{"x":0,"A":1,"b":2,"y":9,"c":3,"list":[-1,4,"x",2,3,null]}`, tree.JSONString())
+	suite.Nil(tree.Find("a"))
+	suite.Equal(int64(1), tree.Find("A").AsInt())
+
+	suite.NoError(tree.Insert("list.0", "first"))
+	suite.NoError(tree.Insert("list.7", "last"))
+	suite.Error(tree.Insert("list.9", 0))
+	suite.NoError(tree.Insert("new.0", true))
+	suite.NoError(tree.Insert("c", 4))
+	suite.Equal(`{"x":0,"A":1,"b":2,"y":9,"c":4,"list":["first",-1,4,"x",2,3,null,"last"],"new":[true]}`, tree.JSONString())
+	suite.Error(tree.Set("list.18446744073709551615", 0))
+	suite.Nil(tree.Find("list.18446744073709551615"))
+
+	/* non-string keys of lenient mode become strings */
+	lenient, err := Decode([]byte(`{1:2,true:1}`))
+	suite.NoError(err)
+	suite.True(lenient.Root.RenameObjectKey("1", "one"))
+	suite.True(lenient.Root.RenameObjectKey("true", "yes"))
+	suite.Equal(int64(2), lenient.Find("one").AsInt())
+	suite.Equal(int64(1), lenient.Root.GetObjectElemByKey("yes").Value.AsInt())
+	suite.Equal(`{"one":2,"yes":1}`, lenient.JSONString())
+
+	/* key index of big object follows reordering */
+	big := New()
+	for i := 0; i < 40; i++ {
+		suite.NoError(big.Set("k"+strconv.Itoa(i), i))
+	}
+	suite.Equal(int64(10), big.Find("k10").AsInt())
+	elem = CreateObjectElem()
+	elem.Key, elem.Value = CreateStringNode().SetString("x"), CreateIntegerNode().SetInt(-1)
+	suite.True(big.Root.InsertObjectElemBefore("k10", elem))
+	suite.True(big.Root.RenameObjectKey("k20", "k20'"))
+	suite.Equal("x", big.Root.ObjectValues[10].Key.AsString())
+	suite.Equal(int64(10), big.Find("k10").AsInt())
+	suite.Equal(int64(-1), big.Find("x").AsInt())
+	suite.Nil(big.Find("k20"))
+	suite.Equal(int64(20), big.Find("k20'").AsInt())
+}
+
+func (suite *JSONTreeTestSuite) TestSetAnyValue() {
+	type item struct {
+		ID int `json:"id"`
+	}
+	node := CreateObjectNode()
+	suite.NoError(node.SetObjectElem("tags", []string{"a"}))
+	suite.NoError(node.SetObjectElem("score", 1.5))
+	suite.NoError(node.SetObjectElem("none", nil))
+	suite.NoError(node.SetObjectElem("item", &item{ID: 1}))
+	suite.NoError(node.SetObjectElem("m", map[string]bool{"ok": true}))
+	suite.Equal(`1.5`, node.Find("score").AsJSON())
+	suite.NoError(node.SetObjectElem("score", float32(0.1)))
+	suite.Equal(`{"tags":["a"],"score":0.1,"none":null,"item":{"id":1},"m":{"ok":true}}`, node.AsJSON())
+
+	list := CreateNode()
+	suite.NoError(list.AddArrayValue("x"))
+	suite.NoError(list.AddArrayValue(CreateBoolNode().SetBool(true)))
+	suite.NoError(list.AddArrayValue([]int{1, 2}))
+	suite.Equal(`["x",true,[1,2]]`, list.AsJSON())
+
+	var te *TypeError
+	suite.True(errors.As(list.SetObjectElem("a", 1), &te))
+	suite.Equal(Array, te.Actual)
+	suite.True(errors.As(node.AddArrayValue(1), &te))
+	suite.Equal(Object, te.Actual)
+	suite.Error(node.SetObjectElem("nan", math.NaN()))
+
+	/* elements failing conversion are errors instead of being dropped, nil pointers are null */
+	list = CreateArrayNode()
+	suite.Error(list.AddArrayValue([]interface{}{1, complex(1, 1), "s"}))
+	suite.Error(list.AddArrayValue(map[string]interface{}{"f": func() {}}))
+	suite.Len(list.ArrayValues, 0)
+	var nilItem *item
+	suite.NoError(list.AddArrayValue([]*item{nilItem, {ID: 2}}))
+	suite.NoError(list.AddArrayValue(map[string]*item{"a": nil}))
+	suite.Equal(`[[null,{"id":2}],{"a":null}]`, list.AsJSON())
+}
+
+func (suite *JSONTreeTestSuite) TestClone() {
+	data := []byte(`{"a":{"b":[1,"x",{"c":null}]},"d.e":true}`)
+	tree, err := Decode(data)
+	suite.NoError(err)
+	cp := tree.Clone()
+	suite.True(tree.Equal(cp))
+	suite.Equal(tree.JSONString(), cp.JSONString())
+	/* copy doesn't alias input or source nodes */
+	for i := range data {
+		data[i] = ' '
+	}
+	suite.Equal(`{"a":{"b":[1,"x",{"c":null}]},"d.e":true}`, cp.JSONString())
+	cp.Find("a.b.1").SetString("y")
+	suite.NotEqual(cp.Find("a.b.1"), tree.Find("a.b.1"))
+	suite.NoError(cp.CheckShared())
+
+	/* graft one subtree into two places */
+	sub := cp.Find("a")
+	cp.Root.SetObjectNodeElem("f", sub)
+	var se *SharedNodeError
+	suite.True(errors.As(cp.CheckShared(), &se))
+	suite.ElementsMatch([]string{"a", "f"}, []string{se.Path, se.OtherPath})
+	cp.Root.SetObjectNodeElem("f", sub.Clone())
+	suite.NoError(cp.CheckShared())
+	cp.Find("f.b.0").SetInt(2)
+	suite.Equal(int64(1), cp.Find("a.b.0").AsInt())
+	suite.Equal(`{"a":{"b":[1,"y",{"c":null}]},"d.e":true,"f":{"b":[2,"y",{"c":null}]}}`, cp.JSONString())
+	cp.Root.SetObjectNodeElem("g", cp.Find(`d\.e`))
+	suite.True(errors.As(cp.CheckShared(), &se))
+	suite.ElementsMatch([]string{`d\.e`, "g"}, []string{se.Path, se.OtherPath})
+
+	/* lazy and lossless trees keep their mode */
+	src := []byte(`{"a": [1, 2], // c
+ "b": {"c": 1}}`)
+	tree, err = DecodeWithOptions(src, DecodeOptions{Lazy: true, JSON5: true, Lossless: true, Positions: true})
+	suite.NoError(err)
+	cp = tree.Clone()
+	for i := range src {
+		src[i] = ' '
+	}
+	suite.NotNil(cp.Root.ObjectValues[1].Value.lazy)
+	out, err := cp.MarshalJSON()
+	suite.NoError(err)
+	suite.Equal("{\"a\": [1, 2], // c\n \"b\": {\"c\": 1}}", string(out))
+	suite.Equal(int64(1), cp.Find("b.c").AsInt())
+	suite.Equal(Pos{Offset: 10, End: 11, Line: 1, Column: 11}, cp.Find("a.1").Pos())
+	suite.Nil((*Node)(nil).Clone())
+
+	/* nil children have no copy */
+	list := CreateArrayNode()
+	list.AddArrayElem(nil).AddArrayElem(CreateIntegerNode().SetInt(1))
+	suite.NotPanics(func() { list.Clone() })
+	obj := CreateObjectNode()
+	obj.AddObjectElem(&ObjectElem{Key: CreateStringNode().SetString("a")})
+	obj.AddObjectElem(&ObjectElem{Value: list})
+	obj.AddObjectElem(&ObjectElem{Value: CreateNode()})
+	cpObj := obj.Clone()
+	suite.True(obj.Equal(cpObj))
+	suite.Nil(cpObj.ObjectValues[0].Value)
+	suite.Nil(cpObj.ObjectValues[1].Key)
+	suite.Nil(cpObj.ObjectValues[1].Value.ArrayValues[0])
+	suite.True(list != cpObj.ObjectValues[1].Value)
+	suite.NoError(obj.AsTree().CheckShared())
+}
+
+func (suite *JSONTreeTestSuite) TestWalk() {
+	tree, err := DecodeWithOptions([]byte(`{"a":{"b":[1,{"c":2}]},"d.e":"x","f":[]}`), DecodeOptions{Lazy: true})
+	suite.NoError(err)
+	var pre []string
+	tree.Walk(func(path Path, parent, node *Node) WalkAction {
+		pre = append(pre, path.String()+"="+node.Type.String())
+		if parent != nil {
+			suite.Equal(node, parent.Find(escapePathKey(path[len(path)-1])))
+		}
+		suite.Equal(node, tree.Find(path.String()))
+		return WalkContinue
+	})
+	suite.Equal([]string{"=Object", "a=Object", "a.b=Array", "a.b.0=Integer", "a.b.1=Object", "a.b.1.c=Integer", `d\.e=String`, "f=Array"}, pre)
+
+	var post []string
+	tree.WalkPostOrder(func(path Path, parent, node *Node) WalkAction {
+		post = append(post, path.String())
+		return WalkContinue
+	})
+	suite.Equal([]string{"a.b.0", "a.b.1.c", "a.b.1", "a.b", "a", `d\.e`, "f", ""}, post)
+
+	/* skip children and stop */
+	var visited []string
+	tree.Walk(func(path Path, parent, node *Node) WalkAction {
+		visited = append(visited, path.String())
+		if path.String() == "a" {
+			return WalkSkip
+		} else if path.String() == `d\.e` {
+			return WalkStop
+		}
+		return WalkContinue
+	})
+	suite.Equal([]string{"", "a", `d\.e`}, visited)
+	visited = visited[:0]
+	tree.WalkPostOrder(func(path Path, parent, node *Node) WalkAction {
+		visited = append(visited, path.String())
+		if node.Type == Object {
+			return WalkStop
+		}
+		return WalkContinue
+	})
+	suite.Equal([]string{"a.b.0", "a.b.1.c", "a.b.1"}, visited)
+
+	/* collect keys, path is copied to keep it */
+	var paths []Path
+	tree.Walk(func(path Path, parent, node *Node) WalkAction {
+		if node.Type == Integer {
+			paths = append(paths, append(Path(nil), path...))
+		}
+		return WalkContinue
+	})
+	suite.Equal([]Path{{"a", "b", "0"}, {"a", "b", "1", "c"}}, paths)
+
+	/* nil object elements are skipped, nil key has empty name */
+	obj := CreateObjectNode()
+	obj.AddObjectElem(&ObjectElem{Value: CreateIntegerNode().SetInt(1)})
+	obj.AddObjectElem(nil)
+	obj.AddObjectElem(&ObjectElem{Key: CreateStringNode().SetString("a"), Value: CreateBoolNode().SetBool(true)})
+	visited = visited[:0]
+	obj.AsTree().Walk(func(path Path, parent, node *Node) WalkAction {
+		visited = append(visited, path.String())
+		return WalkContinue
+	})
+	suite.Equal([]string{"", "", "a"}, visited)
+}
+
+func (suite *JSONTreeTestSuite) TestTransform() {
+	tree, err := Decode([]byte(`{"a":null,"b":{"c":null,"d":[null,{}]},"e":[1,null,2.50],"f":" x ","g":"42","h":"-1.5e3","i":"4 2"}`))
+	suite.NoError(err)
+	tree.Transform(ChainTransform(PruneNulls, PruneEmpty))
+	suite.Equal(`{"e":[1,2.50],"f":" x ","g":"42","h":"-1.5e3","i":"4 2"}`, tree.JSONString())
+	tree.Transform(ChainTransform(TrimStrings, ParseNumericStrings))
+	suite.Equal(`{"e":[1,2.50],"f":"x","g":42,"h":-1.5e3,"i":"4 2"}`, tree.JSONString())
+	suite.Equal(Integer, tree.Find("g").Type)
+	suite.Equal(Float, tree.Find("h").Type)
+	tree.Transform(StringifyNumbers)
+	suite.Equal(`{"e":["1","2.50"],"f":"x","g":"42","h":"-1.5e3","i":"4 2"}`, tree.JSONString())
+
+	/* custom transformation gets original paths, deleting root leaves null */
+	var paths []string
+	tree.Transform(func(path Path, node *Node) (*Node, TransformAction) {
+		paths = append(paths, path.String())
+		if path.String() == "e.0" {
+			return nil, TransformDelete
+		} else if path.String() == "e.1" {
+			return nil, TransformReplace
+		} else if path.String() == "f" {
+			node.SetString("y")
+		}
+		return nil, TransformKeep
+	})
+	suite.Equal([]string{"e.0", "e.1", "e", "f", "g", "h", "i", ""}, paths)
+	suite.Equal(`{"e":[null],"f":"y","g":"42","h":"-1.5e3","i":"4 2"}`, tree.JSONString())
+	tree.Transform(func(path Path, node *Node) (*Node, TransformAction) {
+		return nil, TransformDelete
+	})
+	suite.True(tree.IsNull())
+
+	/* key index of big object is rebuilt after pruning */
+	big := New()
+	for i := 0; i < 40; i++ {
+		var v interface{}
+		if i%2 == 0 {
+			v = i
+		}
+		suite.NoError(big.Set("k"+strconv.Itoa(i), v))
+	}
+	suite.Equal(int64(30), big.Find("k30").AsInt())
+	big.Transform(PruneNulls)
+	suite.Len(big.Root.ObjectValues, 20)
+	suite.Nil(big.Find("k31"))
+	suite.Equal(int64(38), big.Find("k38").AsInt())
+
+	lazy, err := DecodeWithOptions([]byte(`{"a":{"b":[null]},"c":1}`), DecodeOptions{Lazy: true})
+	suite.NoError(err)
+	suite.Equal(`{"c":1}`, lazy.Transform(ChainTransform(PruneNulls, PruneEmpty)).JSONString())
+
+	/* nil object elements are kept */
+	obj := CreateObjectNode()
+	obj.AddObjectElem(nil)
+	obj.AddObjectElem(&ObjectElem{Key: CreateStringNode().SetString("a"), Value: CreateNode()})
+	obj.AddObjectElem(&ObjectElem{Key: CreateStringNode().SetString("b"), Value: CreateIntegerNode().SetInt(1)})
+	obj.AsTree().Transform(PruneNulls)
+	suite.Len(obj.ObjectValues, 2)
+	suite.Nil(obj.ObjectValues[0])
+	suite.Equal(int64(1), obj.ObjectValues[1].Value.AsInt())
+}
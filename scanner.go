@@ -0,0 +1,387 @@
+package qjson
+
+import (
+	"io"
+	"strconv"
+	"strings"
+)
+
+// TokenKind describe a json token kind
+type TokenKind byte
+
+const (
+	// TokenBeginObject means {
+	TokenBeginObject TokenKind = iota + 1
+	// TokenEndObject means }
+	TokenEndObject
+	// TokenBeginArray means [
+	TokenBeginArray
+	// TokenEndArray means ]
+	TokenEndArray
+	// TokenKey means object key, it's a string, or number/bool in lenient mode, or identifier in JSON5 mode
+	TokenKey
+	// TokenString means "any text"
+	TokenString
+	// TokenNumber means integer or float number
+	TokenNumber
+	// TokenBool means true/false
+	TokenBool
+	// TokenNull means null
+	TokenNull
+)
+
+func (k TokenKind) String() string {
+	switch k {
+	case TokenBeginObject:
+		return "BeginObject"
+	case TokenEndObject:
+		return "EndObject"
+	case TokenBeginArray:
+		return "BeginArray"
+	case TokenEndArray:
+		return "EndArray"
+	case TokenKey:
+		return "Key"
+	case TokenString:
+		return "String"
+	case TokenNumber:
+		return "Number"
+	case TokenBool:
+		return "Bool"
+	case TokenNull:
+		return "Null"
+	default:
+		return ""
+	}
+}
+
+// Token represent a json token
+type Token struct {
+	Kind TokenKind
+	// Raw is the token bytes in input, strings keep their quotes and escapes.
+	// In JSON5 mode it may be JSON5 syntax, e.g. single-quoted string or hex number.
+	Raw []byte
+	// Offset of the token in input
+	Offset int
+	/* json5 is true if Raw is not json syntax and should be normalized */
+	json5 bool
+	/* invalidUTF8 is true if Raw has invalid UTF-8 to be replaced */
+	invalidUTF8 bool
+}
+
+// Scanner emits json tokens one by one without building nodes, Decode is built on it too
+type Scanner struct {
+	data     []byte
+	opts     DecodeOptions
+	offset   int
+	done     bool
+	err      error
+	stack    []scanFrame
+	stackBuf [16]scanFrame
+	/* used by duplicate key check */
+	keySets  []map[string]int
+	dupIndex int
+	/* partial is true if data is a chunk of the outermost array without ], see DecodeParallel */
+	partial bool
+}
+
+/* open container in scanner */
+type scanFrame struct {
+	kind      byte
+	state     elemState
+	wantValue bool
+	offset    int
+	count     int
+	key       []byte
+}
+
+// NewScanner create scanner over json bytes
+func NewScanner(jsonBytes []byte) *Scanner {
+	return NewScannerWithOptions(jsonBytes, DecodeOptions{})
+}
+
+// NewScannerWithOptions create scanner over json bytes with decode options
+func NewScannerWithOptions(jsonBytes []byte, opts DecodeOptions) *Scanner {
+	return new(Scanner).init(jsonBytes, opts)
+}
+
+func (s *Scanner) init(jsonBytes []byte, opts DecodeOptions) *Scanner {
+	s.data, s.opts = jsonBytes, opts
+	s.offset, s.done, s.err = 0, false, nil
+	s.stack = s.stackBuf[:0]
+	s.keySets, s.dupIndex = nil, -1
+	s.partial = false
+	if opts.MaxInputBytes > 0 && len(jsonBytes) > opts.MaxInputBytes {
+		s.err = &LimitError{Limit: limitMaxInputBytes, Max: opts.MaxInputBytes}
+	} else if opts.DetectEncoding {
+		s.data = transcodeInput(jsonBytes)
+	}
+	return s
+}
+
+// Depth returns count of open containers
+func (s *Scanner) Depth() int {
+	return len(s.stack)
+}
+
+// Skip skips the rest of innermost open container, then next token would be the one after its end
+func (s *Scanner) Skip() error {
+	depth := len(s.stack)
+	for len(s.stack) >= depth && depth > 0 {
+		if _, err := s.Next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Next returns next token, io.EOF is returned after the whole value scanned
+func (s *Scanner) Next() (Token, error) {
+	if s.err != nil {
+		return Token{}, s.err
+	}
+	tok, err := s.next()
+	if err != nil {
+		s.err = err
+	}
+	return tok, err
+}
+
+func (s *Scanner) next() (Token, error) {
+	if len(s.stack) == 0 {
+		offset := s.skipSpace(s.offset)
+		if s.done {
+			if offset >= 0 {
+				return Token{}, newSyntaxError(s.data, offset, expectEnd)
+			}
+			return Token{}, io.EOF
+		}
+		if offset == -1 {
+			if s.opts.Strict {
+				return Token{}, newSyntaxError(s.data, len(s.data), expectValue)
+			}
+			return Token{}, io.EOF
+		}
+		return s.scanValue(offset, expectValue)
+	}
+	frame := &s.stack[len(s.stack)-1]
+	if frame.wantValue {
+		frame.wantValue = false
+		offset := s.skipSpace(s.offset)
+		if offset == -1 {
+			return Token{}, newSyntaxError(s.data, len(s.data), expectObjectValue)
+		}
+		return s.scanValue(offset, expectObjectValue)
+	}
+	endChar, endKind := arrayEnd, TokenEndArray
+	if frame.kind == objectStart {
+		endChar, endKind = objectEnd, TokenEndObject
+	}
+	offset, end, err := s.nextElem(s.offset, endChar, &frame.state)
+	if err != nil {
+		return Token{}, err
+	}
+	if end {
+		s.stack = s.stack[:len(s.stack)-1]
+		s.done = len(s.stack) == 0
+		return s.token(endKind, offset, offset+1), nil
+	}
+	frame.count++
+	if frame.kind == objectStart {
+		if max := s.opts.MaxObjectKeys; max > 0 && frame.count > max {
+			return Token{}, s.limitError(limitMaxObjectKeys, max, len(s.stack)-1, frame.offset)
+		}
+		return s.scanKey(offset, frame)
+	}
+	if max := s.opts.MaxArrayLen; max > 0 && frame.count > max {
+		return Token{}, s.limitError(limitMaxArrayLen, max, len(s.stack)-1, frame.offset)
+	}
+	return s.scanValue(offset, expectArrayValue)
+}
+
+/* open container at offset */
+func (s *Scanner) push(kind byte, offset int) error {
+	if max := s.opts.MaxDepth; max > 0 && len(s.stack) >= max {
+		return s.limitError(limitMaxDepth, max, len(s.stack), offset)
+	}
+	s.stack = append(s.stack, scanFrame{kind: kind, offset: offset})
+	return nil
+}
+
+func (s *Scanner) checkStringLen(tok Token) error {
+	if max := s.opts.MaxStringLen; max > 0 && len(tok.Raw)-2 > max {
+		return s.limitError(limitMaxStringLen, max, len(s.stack), tok.Offset)
+	}
+	return nil
+}
+
+/* limitError build error with path made of the first depth open containers */
+func (s *Scanner) limitError(limit string, max int, depth int, offset int) *LimitError {
+	return &LimitError{Limit: limit, Max: max, Path: s.path(depth), Offset: offset}
+}
+
+func (s *Scanner) path(depth int) string {
+	var sb strings.Builder
+	for i, frame := range s.stack[:depth] {
+		if i > 0 {
+			sb.WriteByte(dotChar)
+		}
+		if frame.kind == arrayStart {
+			sb.WriteString(strconv.Itoa(frame.count - 1))
+		} else if key, ok := s.unquoteKey(frame.key); ok {
+			sb.WriteString(strings.Replace(string(key), dotString, `\.`, -1))
+		} else {
+			sb.Write(frame.key)
+		}
+	}
+	return sb.String()
+}
+
+func (s *Scanner) unquoteKey(raw []byte) ([]byte, bool) {
+	if s.opts.JSON5 {
+		return unquoteJSON5(raw)
+	}
+	return unquoteBytes(raw)
+}
+
+/* make token and move scanner to end */
+func (s *Scanner) token(kind TokenKind, start, end int) Token {
+	s.offset = end
+	return Token{Kind: kind, Raw: s.data[start:end], Offset: start}
+}
+
+func (s *Scanner) scanValue(offset int, expect string) (Token, error) {
+	jsonBytes := s.data
+	end, kind := -1, TokenNull
+	switch b := jsonBytes[offset]; {
+	case b == objectStart:
+		if err := s.push(objectStart, offset); err != nil {
+			return Token{}, err
+		}
+		return s.token(TokenBeginObject, offset, offset+1), nil
+	case b == arrayStart:
+		if err := s.push(arrayStart, offset); err != nil {
+			return Token{}, err
+		}
+		return s.token(TokenBeginArray, offset, offset+1), nil
+	case b == 'n':
+		if nextValueIsNull(jsonBytes, offset) {
+			end = offset + nullLen
+		}
+	case b == 't' || b == 'f':
+		if nextValueIsBool(jsonBytes, offset) {
+			end, kind = scanBool(jsonBytes, offset), TokenBool
+		}
+	case s.opts.JSON5:
+		return s.scanJSON5Scalar(offset, expect)
+	case s.opts.Strict:
+		tok, err := s.scanStrictScalar(offset, expect)
+		if err == nil && tok.Kind == TokenString {
+			err = s.checkString(&tok)
+		}
+		s.done = err == nil && len(s.stack) == 0
+		return tok, err
+	case b == quote:
+		end, kind = scanString(jsonBytes, offset), TokenString
+	case nextValueIsNumber(jsonBytes, offset):
+		end, kind = scanNumber(jsonBytes, offset), TokenNumber
+	}
+	if end < 0 {
+		return Token{}, newSyntaxError(jsonBytes, offset, expect)
+	}
+	tok := s.token(kind, offset, end)
+	if kind == TokenString {
+		if err := s.checkString(&tok); err != nil {
+			return Token{}, err
+		}
+	}
+	s.done = len(s.stack) == 0
+	return tok, nil
+}
+
+func (s *Scanner) scanKey(offset int, frame *scanFrame) (Token, error) {
+	jsonBytes := s.data
+	var tok Token
+	if s.opts.JSON5 {
+		var err error
+		if tok, err = s.scanJSON5Key(offset); err != nil {
+			return tok, err
+		}
+	} else if s.opts.Strict {
+		if jsonBytes[offset] != quote {
+			return tok, newSyntaxError(jsonBytes, offset, expectStringKey)
+		}
+		var err error
+		if tok, err = s.scanStrictScalar(offset, expectStringKey); err != nil {
+			return tok, err
+		}
+	} else {
+		end := -1
+		if b := jsonBytes[offset]; b == quote {
+			end = scanString(jsonBytes, offset)
+		} else if nextValueIsBool(jsonBytes, offset) {
+			end = scanBool(jsonBytes, offset)
+		} else if nextValueIsNumber(jsonBytes, offset) {
+			end = scanNumber(jsonBytes, offset)
+		}
+		if end < 0 {
+			return tok, newSyntaxError(jsonBytes, offset, expectObjectKey)
+		}
+		tok = s.token(TokenKey, offset, end)
+	}
+	tok.Kind = TokenKey
+	frame.key = tok.Raw
+	if tok.Raw[0] == quote && !s.opts.JSON5 {
+		if err := s.checkString(&tok); err != nil {
+			return tok, err
+		}
+	}
+	if s.opts.DuplicateKeys != DuplicateKeysKeepAll {
+		if err := s.checkDuplicateKey(frame, tok); err != nil {
+			return tok, err
+		}
+	}
+	/* should find : */
+	next := s.skipSpace(s.offset)
+	if next == -1 {
+		return tok, newSyntaxError(jsonBytes, len(jsonBytes), expectColon)
+	} else if jsonBytes[next] != colonChar {
+		return tok, newSyntaxError(jsonBytes, next, expectColon)
+	}
+	s.offset = next + 1
+	frame.wantValue = true
+	return tok, nil
+}
+
+/* search next element of container, commas are skipped in lenient mode, end is true if container closed at next */
+func (s *Scanner) nextElem(offset int, endChar byte, state *elemState) (next int, end bool, err error) {
+	jsonBytes, strict := s.data, s.opts.Strict
+	for {
+		next = s.skipSpace(offset)
+		if next == -1 && s.partial && len(s.stack) == 1 {
+			return 0, false, io.EOF
+		} else if next == -1 {
+			return 0, false, newSyntaxError(jsonBytes, len(jsonBytes), state.expect(strict, endChar))
+		}
+		switch jsonBytes[next] {
+		case endChar:
+			/* JSON5 allows trailing comma */
+			if strict && *state == afterComma && !s.opts.JSON5 {
+				return 0, false, newSyntaxError(jsonBytes, next, state.expect(true, endChar))
+			}
+			return next, true, nil
+		case commaChar:
+			if strict && *state != afterElem {
+				return 0, false, newSyntaxError(jsonBytes, next, state.expect(true, endChar))
+			}
+			*state = afterComma
+			offset = next + 1
+			continue
+		}
+		if strict && *state == afterElem {
+			return 0, false, newSyntaxError(jsonBytes, next, state.expect(true, endChar))
+		}
+		*state = afterElem
+		return next, false, nil
+	}
+}
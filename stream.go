@@ -0,0 +1,254 @@
+package qjson
+
+import (
+	"bytes"
+	"io"
+)
+
+const minReadSize = 512
+
+// Decoder reads and decodes json values one by one from an input stream,
+// values may be separated by any whitespace, so newline-delimited json is supported too.
+// The internal buffer only holds the value being decoded.
+type Decoder struct {
+	r     io.Reader
+	opts  DecodeOptions
+	buf   []byte
+	scanp int   // start of unread data in buf
+	rerr  error // error from reader
+	err   error // sticky decode error
+	scan  valueScanner
+
+	/* position of buf[scanp] in the whole stream */
+	offset int
+	line   int
+	column int
+}
+
+// NewDecoder returns a new decoder that reads from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r, line: 1, column: 1}
+}
+
+// SetOptions set options used to decode every value
+func (dec *Decoder) SetOptions(opts DecodeOptions) *Decoder {
+	dec.opts = opts
+	return dec
+}
+
+// More reports whether there is another value in the stream
+func (dec *Decoder) More() bool {
+	return dec.err == nil && dec.skipSpaces() == nil
+}
+
+// Decode reads next json value from stream, io.EOF is returned if nothing left
+func (dec *Decoder) Decode() (*JSONTree, error) {
+	if dec.err != nil {
+		return nil, dec.err
+	}
+	if err := dec.skipSpaces(); err != nil {
+		return nil, err
+	}
+	dec.scan.reset(dec.opts.JSON5)
+	for {
+		if end := dec.scan.scan(dec.buf[dec.scanp:], dec.rerr == io.EOF); end >= 0 {
+			return dec.decodeValue(end)
+		}
+		if max := dec.opts.MaxInputBytes; max > 0 && dec.scan.pos > max {
+			dec.err = &LimitError{Limit: limitMaxInputBytes, Max: max, Offset: dec.offset}
+			return nil, dec.err
+		}
+		if dec.rerr != nil {
+			dec.err = dec.rerr
+			return nil, dec.err
+		}
+		dec.refill()
+	}
+}
+
+func (dec *Decoder) decodeValue(end int) (*JSONTree, error) {
+	/* the buffer would be overwritten later, so tree should not alias it */
+	data := copyBytes(dec.buf[dec.scanp : dec.scanp+end])
+	tree, err := decodeTree(data, dec.opts, Pos{Offset: dec.offset, Line: dec.line, Column: dec.column})
+	switch e := err.(type) {
+	case *SyntaxError:
+		e.Offset += dec.offset
+		if e.Line == 1 {
+			e.Column += dec.column - 1
+		}
+		e.Line += dec.line - 1
+	case *LimitError:
+		e.Offset += dec.offset
+	case *DuplicateKeyError:
+		e.Offset += dec.offset
+	}
+	dec.consume(end)
+	if err != nil {
+		dec.err = err
+		return nil, err
+	}
+	return tree, nil
+}
+
+/* skip whitespaces and JSON5 comments between values, return nil only if a value follows */
+func (dec *Decoder) skipSpaces() error {
+	if dec.offset == 0 && dec.opts.DetectEncoding {
+		dec.skipBOM()
+	}
+	for {
+		for dec.scanp < len(dec.buf) {
+			if b := dec.buf[dec.scanp]; nonsenseChars.Contains(b) {
+				dec.consume(1)
+				continue
+			} else if !dec.opts.JSON5 || b != slashChar {
+				return nil
+			}
+			n := skipComment(dec.buf[dec.scanp:], dec.rerr != nil)
+			if n == 0 {
+				return nil
+			} else if n < 0 {
+				break
+			}
+			dec.consume(n)
+		}
+		if dec.rerr != nil {
+			return dec.rerr
+		}
+		dec.refill()
+	}
+}
+
+/* drop UTF-8 BOM at the beginning of stream, Decoder doesn't transcode UTF-16 or UTF-32 stream */
+func (dec *Decoder) skipBOM() {
+	for len(dec.buf)-dec.scanp < len(bomUTF8) && dec.rerr == nil {
+		dec.refill()
+	}
+	if bytes.HasPrefix(dec.buf[dec.scanp:], bomUTF8) {
+		dec.consume(len(bomUTF8))
+		dec.column = 1
+	}
+}
+
+/* drop n bytes from unread data and track stream position */
+func (dec *Decoder) consume(n int) {
+	for _, b := range dec.buf[dec.scanp : dec.scanp+n] {
+		if b == '\n' {
+			dec.line++
+			dec.column = 1
+		} else if b < 0x80 || b >= 0xC0 {
+			dec.column++
+		}
+	}
+	dec.offset += n
+	dec.scanp += n
+}
+
+/* read more data into buffer, buffer only grows when current value can't fit in */
+func (dec *Decoder) refill() {
+	if dec.scanp > 0 {
+		n := copy(dec.buf, dec.buf[dec.scanp:])
+		dec.buf = dec.buf[:n]
+		dec.scanp = 0
+	}
+	if cap(dec.buf)-len(dec.buf) < minReadSize {
+		newBuf := make([]byte, len(dec.buf), 2*cap(dec.buf)+minReadSize)
+		copy(newBuf, dec.buf)
+		dec.buf = newBuf
+	}
+	n, err := dec.r.Read(dec.buf[len(dec.buf):cap(dec.buf)])
+	dec.buf = dec.buf[:len(dec.buf)+n]
+	dec.rerr = err
+}
+
+/* valueScanner finds where a top-level value ends, it can be resumed when more data arrives */
+type valueScanner struct {
+	stack     []byte
+	json5     bool
+	inString  bool
+	quoteChar byte
+	escaped   bool
+	scalar    bool
+	pos       int
+}
+
+func (s *valueScanner) reset(json5 bool) {
+	s.stack = s.stack[:0]
+	s.json5 = json5
+	s.inString, s.escaped, s.scalar = false, false, false
+	s.pos = 0
+}
+
+/* scan data which starts with the value, return end offset of value or -1 if more data needed */
+func (s *valueScanner) scan(data []byte, atEOF bool) int {
+	for ; s.pos < len(data); s.pos++ {
+		b := data[s.pos]
+		if s.inString {
+			if s.escaped {
+				s.escaped = false
+			} else if b == escapeChar {
+				s.escaped = true
+			} else if b == s.quoteChar {
+				s.inString = false
+				if len(s.stack) == 0 {
+					return s.pos + 1
+				}
+			}
+			continue
+		}
+		if s.json5 && b == slashChar {
+			/* comment is never part of value, rescan it when more data comes */
+			n := skipComment(data[s.pos:], atEOF)
+			if n < 0 {
+				return -1
+			} else if n > 0 {
+				if s.scalar {
+					return s.pos
+				}
+				s.pos += n - 1
+				continue
+			}
+		}
+		if s.scalar {
+			if isValueDelimiter(b) || (s.json5 && b == singleQuote) {
+				return s.pos
+			}
+			continue
+		}
+		switch b {
+		case quote:
+			s.inString, s.quoteChar = true, quote
+		case singleQuote:
+			if s.json5 {
+				s.inString, s.quoteChar = true, singleQuote
+			} else if len(s.stack) == 0 {
+				s.scalar = true
+			}
+		case objectStart, arrayStart:
+			s.stack = append(s.stack, b)
+		case objectEnd, arrayEnd:
+			/* mismatched close char ends the value, decoder would report it */
+			if len(s.stack) == 0 || (b == objectEnd) != (s.stack[len(s.stack)-1] == objectStart) {
+				return s.pos + 1
+			}
+			if s.stack = s.stack[:len(s.stack)-1]; len(s.stack) == 0 {
+				return s.pos + 1
+			}
+		default:
+			if len(s.stack) == 0 {
+				s.scalar = true
+			}
+		}
+	}
+	if atEOF {
+		return len(data)
+	}
+	return -1
+}
+
+func isValueDelimiter(b byte) bool {
+	switch b {
+	case objectStart, objectEnd, arrayStart, arrayEnd, quote, commaChar, colonChar:
+		return true
+	}
+	return nonsenseChars.Contains(b)
+}
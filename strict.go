@@ -0,0 +1,155 @@
+package qjson
+
+import "unicode/utf8"
+
+/* expected token kinds only reported in strict mode */
+const (
+	expectStringKey      = "string key"
+	expectStringKeyOrEnd = "string key or '}'"
+	expectCommaObjectEnd = "',' or '}'"
+	expectCommaArrayEnd  = "',' or ']'"
+	expectStringKeyOnly  = "string key after ','"
+	expectValueOnly      = "array value after ','"
+	expectDigit          = "digit"
+	expectQuote          = "'\"'"
+	expectEscapeChar     = "escape char"
+	expectHexDigit       = "hex digit"
+	expectEscapedControl = "escaped control char"
+	expectValidUTF8      = "valid UTF-8"
+)
+
+/* where the scanner stands in a container */
+type elemState byte
+
+const (
+	containerStart elemState = iota
+	afterElem
+	afterComma
+)
+
+func (s elemState) expect(strict bool, endChar byte) string {
+	if endChar == objectEnd {
+		if !strict {
+			return expectObjectKey
+		}
+		switch s {
+		case afterElem:
+			return expectCommaObjectEnd
+		case afterComma:
+			return expectStringKeyOnly
+		}
+		return expectStringKeyOrEnd
+	}
+	if !strict {
+		return expectArrayValue
+	}
+	switch s {
+	case afterElem:
+		return expectCommaArrayEnd
+	case afterComma:
+		return expectValueOnly
+	}
+	return expectArrayValue
+}
+
+/* scan string or number token which must conform to RFC 8259 */
+func (s *Scanner) scanStrictScalar(offset int, expect string) (Token, error) {
+	jsonBytes := s.data
+	switch b := jsonBytes[offset]; {
+	case b == quote:
+		end, errOffset, errExpect := scanStrictString(jsonBytes, offset)
+		if errOffset >= 0 {
+			return Token{}, newSyntaxError(jsonBytes, errOffset, errExpect)
+		}
+		return s.token(TokenString, offset, end), nil
+	case b == negativeChar || isIntegerChar(b):
+		end, errOffset := scanStrictNumber(jsonBytes, offset)
+		if errOffset >= 0 {
+			return Token{}, newSyntaxError(jsonBytes, errOffset, expectDigit)
+		}
+		return s.token(TokenNumber, offset, end), nil
+	}
+	return Token{}, newSyntaxError(jsonBytes, offset, expect)
+}
+
+/* scan number like -?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?, errOffset is -1 if ok */
+func scanStrictNumber(jsonBytes []byte, offset int) (end int, errOffset int) {
+	i := offset
+	if jsonBytes[i] == negativeChar {
+		i++
+	}
+	if i >= len(jsonBytes) || !isIntegerChar(jsonBytes[i]) {
+		return 0, i
+	}
+	if jsonBytes[i] == '0' {
+		i++
+	} else {
+		i = skipDigits(jsonBytes, i)
+	}
+	if i < len(jsonBytes) && jsonBytes[i] == dotChar {
+		if i++; i >= len(jsonBytes) || !isIntegerChar(jsonBytes[i]) {
+			return 0, i
+		}
+		i = skipDigits(jsonBytes, i)
+	}
+	if i < len(jsonBytes) && (jsonBytes[i] == scientificNotationLower || jsonBytes[i] == scientificNotationUpper) {
+		if i++; i < len(jsonBytes) && (jsonBytes[i] == scientificNotationPlus || jsonBytes[i] == scientificNotationMinus) {
+			i++
+		}
+		if i >= len(jsonBytes) || !isIntegerChar(jsonBytes[i]) {
+			return 0, i
+		}
+		i = skipDigits(jsonBytes, i)
+	}
+	return i, -1
+}
+
+func skipDigits(jsonBytes []byte, offset int) int {
+	for offset < len(jsonBytes) && isIntegerChar(jsonBytes[offset]) {
+		offset++
+	}
+	return offset
+}
+
+/* scan quoted string with valid escapes and UTF-8 only, errOffset is -1 if ok */
+func scanStrictString(jsonBytes []byte, offset int) (end int, errOffset int, expect string) {
+	for i := offset + 1; i < len(jsonBytes); {
+		b := jsonBytes[i]
+		switch {
+		case b == quote:
+			return i + 1, -1, ""
+		case b == escapeChar:
+			if i+1 >= len(jsonBytes) {
+				return 0, i + 1, expectEscapeChar
+			}
+			switch jsonBytes[i+1] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+				i += 2
+			case 'u':
+				for j := i + 2; j < i+6; j++ {
+					if j >= len(jsonBytes) || !isHexChar(jsonBytes[j]) {
+						return 0, j, expectHexDigit
+					}
+				}
+				i += 6
+			default:
+				return 0, i + 1, expectEscapeChar
+			}
+		case b < ' ':
+			return 0, i, expectEscapedControl
+		case b < utf8.RuneSelf:
+			i++
+		default:
+			r, size := utf8.DecodeRune(jsonBytes[i:])
+			if r == utf8.RuneError && size == 1 {
+				return 0, i, expectValidUTF8
+			}
+			i += size
+		}
+	}
+	return 0, len(jsonBytes), expectQuote
+}
+
+func isHexChar(b byte) bool {
+	return isIntegerChar(b) || (b >= 'a' && b <= 'f') || (b >= 'A' && b <= 'F')
+}
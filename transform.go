@@ -0,0 +1,173 @@
+package qjson
+
+import "strings"
+
+// TransformAction tells Transform what to do with a node
+type TransformAction int
+
+const (
+	// TransformKeep keep node, changes made to node in place are kept too
+	TransformKeep TransformAction = iota
+	// TransformReplace replace node by the returned node, nil is replaced by null
+	TransformReplace
+	// TransformDelete remove node from its parent, root is replaced by null
+	TransformDelete
+)
+
+// TransformFunc is called for every node, it returns the new node for TransformReplace
+type TransformFunc func(path Path, node *Node) (*Node, TransformAction)
+
+// Transform visit every node in post order like WalkPostOrder and keep, replace or delete it.
+// Children are transformed before their parent, so the parent sees its transformed children,
+// e.g. an object whose values are all deleted is empty when it's visited. path is the path in the original tree.
+func (tree *JSONTree) Transform(fn TransformFunc) *JSONTree {
+	/* new node of replaced or deleted nodes, parent applies them when it's visited */
+	changes := make(map[*Node]*Node)
+	walkNode(tree.Root, func(path Path, parent, node *Node) WalkAction {
+		if node == nil {
+			return WalkContinue
+		}
+		if len(changes) > 0 && isContainer(node) {
+			applyChanges(node, changes)
+		}
+		switch out, action := fn(path, node); action {
+		case TransformReplace:
+			if out == nil {
+				out = CreateNode()
+			}
+			if out != node {
+				changes[node] = out
+			}
+		case TransformDelete:
+			changes[node] = nil
+		}
+		return WalkContinue
+	}, true)
+	if out, ok := changes[tree.Root]; ok {
+		if out == nil {
+			out = CreateNode()
+		}
+		tree.Root = out
+	}
+	return tree
+}
+
+/* applyChanges replace or remove children of container */
+func applyChanges(node *Node, changes map[*Node]*Node) {
+	values := node.ObjectValues[:0]
+	for _, elem := range node.ObjectValues {
+		if elem == nil {
+			values = append(values, elem)
+		} else if out, keep := takeChange(changes, elem.Value); keep {
+			elem.Value = out
+			values = append(values, elem)
+		}
+	}
+	if len(values) < len(node.ObjectValues) {
+		node.storeIndex(nil)
+		/* drop removed elements from the tail of backing array */
+		for i := len(values); i < len(node.ObjectValues); i++ {
+			node.ObjectValues[i] = nil
+		}
+	}
+	node.ObjectValues = values
+	list := node.ArrayValues[:0]
+	for _, elem := range node.ArrayValues {
+		if out, keep := takeChange(changes, elem); keep {
+			list = append(list, out)
+		}
+	}
+	for i := len(list); i < len(node.ArrayValues); i++ {
+		node.ArrayValues[i] = nil
+	}
+	node.ArrayValues = list
+}
+
+/* takeChange returns the node replacing n, keep is false if n is deleted */
+func takeChange(changes map[*Node]*Node, n *Node) (out *Node, keep bool) {
+	out, ok := changes[n]
+	if !ok {
+		return n, true
+	}
+	delete(changes, n)
+	return out, out != nil
+}
+
+// ChainTransform apply transformations to every node in order, it stops at the first deletion
+func ChainTransform(fns ...TransformFunc) TransformFunc {
+	return func(path Path, node *Node) (*Node, TransformAction) {
+		action := TransformKeep
+		for _, fn := range fns {
+			out, act := fn(path, node)
+			switch act {
+			case TransformDelete:
+				return nil, TransformDelete
+			case TransformReplace:
+				if out == nil {
+					out = CreateNode()
+				}
+				node, action = out, TransformReplace
+			}
+		}
+		return node, action
+	}
+}
+
+// PruneNulls remove null values from objects and arrays
+func PruneNulls(path Path, node *Node) (*Node, TransformAction) {
+	if node.Type == Null {
+		return nil, TransformDelete
+	}
+	return nil, TransformKeep
+}
+
+// PruneEmpty remove empty objects and arrays, containers becoming empty by pruning are removed too
+func PruneEmpty(path Path, node *Node) (*Node, TransformAction) {
+	if isContainer(node) && len(node.expand().ObjectValues) == 0 && len(node.ArrayValues) == 0 {
+		return nil, TransformDelete
+	}
+	return nil, TransformKeep
+}
+
+// StringifyNumbers replace numbers by strings of their json text, e.g. 1.50 becomes "1.50"
+func StringifyNumbers(path Path, node *Node) (*Node, TransformAction) {
+	if node.IsNumber() {
+		return CreateStringNode().SetString(node.Value), TransformReplace
+	}
+	return nil, TransformKeep
+}
+
+// ParseNumericStrings replace strings holding a json number by the number, e.g. "42" becomes 42, " 42" is kept
+func ParseNumericStrings(path Path, node *Node) (*Node, TransformAction) {
+	if node.Type != String {
+		return nil, TransformKeep
+	}
+	s, err := node.TryAsString()
+	if err != nil || s == "" {
+		return nil, TransformKeep
+	}
+	if end, errOffset := scanStrictNumber(stringToBytes(s), 0); errOffset >= 0 || end != len(s) {
+		return nil, TransformKeep
+	}
+	out := CreateFloatNode()
+	if isIntegerText(s) {
+		out.Type = Integer
+	}
+	out.Value = s
+	return out, TransformReplace
+}
+
+// TrimStrings trim leading and trailing white space of string values, object keys are kept
+func TrimStrings(path Path, node *Node) (*Node, TransformAction) {
+	if node.Type != String {
+		return nil, TransformKeep
+	}
+	s, err := node.TryAsString()
+	if err != nil {
+		return nil, TransformKeep
+	}
+	if trimmed := strings.TrimSpace(s); trimmed != s {
+		return CreateStringNode().SetString(trimmed), TransformReplace
+	}
+	return nil, TransformKeep
+}
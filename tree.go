@@ -1,5 +1,11 @@
 package qjson
 
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
 // JSONTree represent full json
 type JSONTree struct {
 	Root *Node
@@ -12,15 +18,25 @@ func (tree *JSONTree) IsNull() bool {
 	return tree.Root == nil || tree.Root.IsNull()
 }
 
-// MarshalJSON json marshaller
+// MarshalJSON json marshaller, text before and after root value is kept for tree decoded with DecodeOptions.Lossless
 func (tree *JSONTree) MarshalJSON() ([]byte, error) {
+	if tr := tree.Root.nodeTrivia(); tr != nil {
+		buf := bytesPool.Get().(*bytes.Buffer)
+		buf.Reset()
+		defer bytesPool.Put(buf)
+		buf.WriteString(tr.before)
+		nodeMarshalJSON(buf, tree.Root)
+		buf.WriteString(tr.after)
+		return copyBytes(buf.Bytes()), nil
+	}
 	return tree.Root.MarshalJSON()
 }
 
 // UnmarshalJSON json unmarshaller
 func (tree *JSONTree) UnmarshalJSON(data []byte) (err error) {
 	var tree1 *JSONTree
-	if tree1, err = Decode(data); err != nil {
+	/* data may be a reused buffer of json.Decoder */
+	if tree1, err = DecodeWithOptions(data, DecodeOptions{Copy: true}); err != nil {
 		return err
 	}
 	*tree = *tree1
@@ -85,6 +101,179 @@ func (tree *JSONTree) Remove(path string) {
 	}
 }
 
+// Set value by path, value is converted like ConvertToJSONTree, *Node and *JSONTree are set as they are.
+// See SetNode for how missing containers are created.
+func (tree *JSONTree) Set(path string, value interface{}) error {
+	node, err := converterInst.toNode(value)
+	if err != nil {
+		return err
+	}
+	return tree.SetNode(path, node)
+}
+
+// SetNode set node by path, missing objects along the path are created, or arrays if the next path segment is an integer.
+// Null is replaced by the container too, and arrays are padded with null up to the index.
+// Error is returned if the path goes through a string, number or bool, or uses an array selector.
+func (tree *JSONTree) SetNode(path string, node *Node) error {
+	return tree.setNode(path, node, false)
+}
+
+// Insert value into array by path, elements from the index are moved backward, e.g. Insert("items.0", v) prepends v to items.
+// Missing containers are created like SetNode, the index must not be greater than array length.
+// Insert works like Set if the last path segment is an object key.
+func (tree *JSONTree) Insert(path string, value interface{}) error {
+	node, err := converterInst.toNode(value)
+	if err != nil {
+		return err
+	}
+	return tree.setNode(path, node, true)
+}
+
+/* setNode set or insert node by path */
+func (tree *JSONTree) setNode(path string, node *Node, insert bool) error {
+	paths, ok := makeStPath(path)
+	if !ok {
+		return fmt.Errorf("invalid path %q", path)
+	}
+	for _, p := range paths {
+		if p.isArrayElemSelector() {
+			return fmt.Errorf("can not set by array selector of path %q", path)
+		}
+	}
+	if node == nil {
+		node = CreateNode()
+	}
+	if len(paths) == 0 {
+		tree.Root = node
+		return nil
+	}
+	if tree.Root == nil {
+		tree.Root = CreateNode()
+	}
+	parent := tree.Root
+	for i, p := range paths {
+		/* the last segment holds node, others hold null to be turned into container */
+		child := node
+		if i < len(paths)-1 {
+			child = nil
+		}
+		next, err := setChild(parent.expand(), p, child, insert)
+		if err != nil {
+			return errorAtPath(err, joinStPath(paths[:i]))
+		}
+		parent = next
+	}
+	return nil
+}
+
+/* setChild set or insert child of parent by path segment, child is nil to get existing child or create null, the child is returned */
+func setChild(parent *Node, p stPath, child *Node, insert bool) (*Node, error) {
+	if parent.Type == Null {
+		parent.Value, parent.Type = emptyVal, Object
+		if p.isInteger() {
+			parent.Type = Array
+		}
+	}
+	switch {
+	case parent.Type == Object:
+		if i := parent.objectIndexOf(p.Name); i >= 0 {
+			elem := parent.ObjectValues[i]
+			if child != nil {
+				elem.Value = child
+			}
+			return elem.Value, nil
+		}
+		if child == nil {
+			child = CreateNode()
+		}
+		parent.SetObjectNodeElem(p.Name, child)
+		return child, nil
+	case parent.Type == Array && p.isInteger() && insert && child != nil:
+		if !parent.InsertArrayElem(p.asInteger(), child) {
+			return nil, fmt.Errorf("array index %s out of range [0, %d]", p.Name, len(parent.ArrayValues))
+		}
+		return child, nil
+	case parent.Type == Array && p.isInteger():
+		i := p.asInteger()
+		for len(parent.ArrayValues) <= i {
+			parent.ArrayValues = append(parent.ArrayValues, CreateNode())
+		}
+		if child != nil {
+			parent.ArrayValues[i] = child
+		}
+		return parent.ArrayValues[i], nil
+	case parent.Type == Array:
+		return nil, fmt.Errorf("array index %q is not an integer", p.Name)
+	}
+	return nil, &TypeError{Expected: []NodeType{Object, Array, Null}, Actual: parent.Type}
+}
+
+/* joinStPath format path segments in the syntax of JSONTree.Find */
+func joinStPath(paths []stPath) string {
+	names := make([]string, len(paths))
+	for i, p := range paths {
+		names[i] = escapePathKey(p.Name)
+	}
+	return strings.Join(names, dotString)
+}
+
+/* escapePathKey escape dots of object key in path */
+func escapePathKey(key string) string {
+	return strings.Replace(key, dotString, `\.`, -1)
+}
+
+// Detach copies all values of tree into memory owned by tree, so the tree no longer aliases decode input
+func (tree *JSONTree) Detach() *JSONTree {
+	detachNode(tree.Root)
+	return tree
+}
+
+/* copy values, lazy spans and trivia of node and offspring into one buffer */
+func detachNode(root *Node) {
+	var nodes []*Node
+	var size int
+	stack := []*Node{root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if node == nil {
+			continue
+		}
+		nodes = append(nodes, node)
+		/* index keys alias old values */
+		node.storeIndex(nil)
+		size += len(node.Value)
+		if node.lazy != nil {
+			size += len(node.lazy.raw)
+		}
+		if tr := node.nodeTrivia(); tr != nil {
+			size += len(tr.before) + len(tr.after) + len(tr.raw) + len(tr.value) + len(tr.end)
+		}
+		for _, elem := range node.ObjectValues {
+			stack = append(stack, elem.Key, elem.Value)
+		}
+		stack = append(stack, node.ArrayValues...)
+	}
+	buf := make([]byte, 0, size)
+	for _, node := range nodes {
+		start := len(buf)
+		buf = append(buf, node.Value...)
+		node.Value = bytesToString(buf[start:len(buf):len(buf)])
+		if node.lazy != nil {
+			start = len(buf)
+			buf = append(buf, node.lazy.raw...)
+			node.lazy.raw = buf[start:len(buf):len(buf)]
+		}
+		if tr := node.nodeTrivia(); tr != nil {
+			for _, s := range []*string{&tr.before, &tr.after, &tr.raw, &tr.value, &tr.end} {
+				start = len(buf)
+				buf = append(buf, *s...)
+				*s = bytesToString(buf[start:len(buf):len(buf)])
+			}
+		}
+	}
+}
+
 // Equal two json tree
 func (tree *JSONTree) Equal(t2 *JSONTree) bool {
 	return tree.Root.Equal(t2.Root)
@@ -0,0 +1,103 @@
+package qjson
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Path of node in json tree, segments are unescaped object keys or array indexes
+type Path []string
+
+// String format path in the syntax of JSONTree.Find, dots in keys are escaped
+func (p Path) String() string {
+	names := make([]string, len(p))
+	for i, name := range p {
+		names[i] = escapePathKey(name)
+	}
+	return strings.Join(names, dotString)
+}
+
+// WalkAction tells walker how to go on after visiting a node
+type WalkAction int
+
+const (
+	// WalkContinue go on walking
+	WalkContinue WalkAction = iota
+	// WalkSkip skip children of the node, it works like WalkContinue in post order
+	WalkSkip
+	// WalkStop stop walking
+	WalkStop
+)
+
+// WalkFunc is called for every node, parent of root is nil.
+// path is reused by walker, copy it to keep it after the call.
+type WalkFunc func(path Path, parent, node *Node) WalkAction
+
+/* walkFrame is a node waiting to be visited, path of node is path[:depth] plus name */
+type walkFrame struct {
+	parent, node *Node
+	depth        int
+	name         string
+	visited      bool
+}
+
+// Walk visit every node depth-first in pre order, containers are visited before their children, children in order.
+// Lazy containers are expanded.
+func (tree *JSONTree) Walk(fn WalkFunc) {
+	walkNode(tree.Root, fn, false)
+}
+
+// WalkPostOrder visit every node depth-first in post order, containers are visited after their children
+func (tree *JSONTree) WalkPostOrder(fn WalkFunc) {
+	walkNode(tree.Root, fn, true)
+}
+
+/* walkNode walk with an explicit stack, so that deep nesting won't grow goroutine stack */
+func walkNode(root *Node, fn WalkFunc, postOrder bool) {
+	if root == nil {
+		return
+	}
+	var path Path
+	stack := []walkFrame{{node: root, depth: -1}}
+	for len(stack) > 0 {
+		frame := stack[len(stack)-1]
+		node := frame.node
+		/* root has no path segment */
+		if frame.depth >= 0 {
+			path = append(path[:frame.depth], frame.name)
+		} else {
+			path = path[:0]
+		}
+		if !postOrder {
+			stack = stack[:len(stack)-1]
+			if action := fn(path, frame.parent, node); action == WalkStop {
+				return
+			} else if action == WalkSkip || !isContainer(node) {
+				continue
+			}
+		} else if frame.visited || !isContainer(node) {
+			stack = stack[:len(stack)-1]
+			if fn(path, frame.parent, node) == WalkStop {
+				return
+			}
+			continue
+		} else {
+			stack[len(stack)-1].visited = true
+		}
+		/* push children in reverse order, so they are popped in order */
+		depth := len(path)
+		node.expand()
+		for i := len(node.ObjectValues) - 1; i >= 0; i-- {
+			if elem := node.ObjectValues[i]; elem != nil {
+				stack = append(stack, walkFrame{parent: node, node: elem.Value, depth: depth, name: keyName(elem.Key)})
+			}
+		}
+		for i := len(node.ArrayValues) - 1; i >= 0; i-- {
+			stack = append(stack, walkFrame{parent: node, node: node.ArrayValues[i], depth: depth, name: strconv.Itoa(i)})
+		}
+	}
+}
+
+func isContainer(n *Node) bool {
+	return n != nil && (n.Type == Object || n.Type == Array)
+}